@@ -0,0 +1,110 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/doc"
+	"github.com/Unknwon/gowalker/modules/storage"
+)
+
+// command represents an administrative task that runs instead of the server.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"gc":       {"Remove blobs in storage that are not used by any package", runGC},
+	"rerender": {"Render documentation of all packages from snapshots without fetching", runRerender},
+}
+
+// runCommand runs command of given name and exits on error.
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(os.Stderr, "Usage: gowalker [command] [flags]\n\nCommands:")
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+		}
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		log.FatalD(4, "%s: %v", name, err)
+	}
+}
+
+func runGC(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	grace := flags.Duration("grace", time.Hour, "keep unused blobs newer than this, they may belong to generations in progress")
+	flags.Parse(args)
+
+	keys, err := models.GetBlobKeys()
+	if err != nil {
+		return fmt.Errorf("get blob keys: %v", err)
+	}
+
+	n, err := storage.GC(keys, *grace)
+	if err != nil {
+		return err
+	}
+	log.Info("Removed %d unused blobs", n)
+	return nil
+}
+
+func runRerender(args []string) error {
+	flags := flag.NewFlagSet("rerender", flag.ExitOnError)
+	flags.Parse(args)
+
+	render := newRender()
+	var lastID int64
+	var numDone, numFailed int
+	for {
+		pinfos, err := models.GetSnapshotPkgInfos(lastID, 100)
+		if err != nil {
+			return fmt.Errorf("get packages: %v", err)
+		} else if len(pinfos) == 0 {
+			break
+		}
+
+		for _, pinfo := range pinfos {
+			lastID = pinfo.ID
+			// Failed ones are left as they are, they are refreshed by next crawl.
+			if err = doc.RerenderPackage(render, pinfo); err != nil {
+				log.Error("Fail to rerender %s: %v", pinfo.DocPath(), err)
+				numFailed++
+				continue
+			}
+			numDone++
+		}
+		log.Info("Rerendered %d packages, %d failed", numDone, numFailed)
+	}
+	return nil
+}
@@ -18,6 +18,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"runtime"
 	"strings"
 
@@ -27,8 +29,13 @@ import (
 	"github.com/go-macaron/session"
 	"gopkg.in/macaron.v1"
 
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/base"
 	"github.com/Unknwon/gowalker/modules/context"
+	"github.com/Unknwon/gowalker/modules/crawler"
+	"github.com/Unknwon/gowalker/modules/doc"
 	"github.com/Unknwon/gowalker/modules/setting"
+	"github.com/Unknwon/gowalker/modules/storage"
 	"github.com/Unknwon/gowalker/routers"
 	"github.com/Unknwon/gowalker/routers/apiv1"
 )
@@ -40,6 +47,24 @@ func init() {
 	setting.AppVer = APP_VER
 }
 
+func newPongoer() macaron.Handler {
+	return pongo2.Pongoer(pongo2.Options{
+		IndentJSON: !setting.ProdMode,
+	})
+}
+
+// newRender returns a renderer that works out of requests for background jobs.
+func newRender() (render macaron.Render) {
+	m := macaron.New()
+	m.Use(newPongoer())
+	m.Get("/", func(r macaron.Render) {
+		render = r
+	})
+	req, _ := http.NewRequest("GET", "/", nil)
+	m.ServeHTTP(httptest.NewRecorder(), req)
+	return render
+}
+
 // newMacaron initializes Macaron instance.
 func newMacaron() *macaron.Macaron {
 	m := macaron.New()
@@ -55,19 +80,35 @@ func newMacaron() *macaron.Macaron {
 			Prefix:      "raw",
 			SkipLogging: setting.ProdMode,
 		}))
-	m.Use(pongo2.Pongoer(pongo2.Options{
-		IndentJSON: !setting.ProdMode,
-	}))
+	m.Use(newPongoer())
 	m.Use(i18n.I18n())
 	m.Use(session.Sessioner())
 	m.Use(context.Contexter())
 	return m
 }
 
+// globalInit loads configuration and initializes services in order.
+func globalInit() {
+	setting.Init()
+	models.Init()
+	storage.Init()
+	doc.Init()
+}
+
 func main() {
+	globalInit()
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	log.Info("Go Walker %s", APP_VER)
 	log.Info("Run Mode: %s", strings.Title(macaron.Env))
 
+	if !setting.ProdMode {
+		base.MonitorI18nLocale()
+	}
+
 	m := newMacaron()
 	m.Get("/", routers.Home)
 	m.Get("/search", routers.Search)
@@ -76,8 +117,12 @@ func main() {
 	m.Group("/api", func() {
 		m.Group("/v1", func() {
 			m.Get("/badge", apiv1.Badge)
+			m.Get("/pkg/*", apiv1.Package)
+			m.Get("/diff/*", apiv1.Diff)
+			m.Get("/jobs/:id", apiv1.Job)
 		})
 	})
+	m.Get("/diff/*", routers.Diff)
 
 	m.Get("/robots.txt", func() string {
 		return `User-agent: *
@@ -85,6 +130,8 @@ Disallow: /search`
 	})
 	m.Get("/*", routers.Docs)
 
+	crawler.Start(newRender())
+
 	listenAddr := fmt.Sprintf("0.0.0.0:%d", setting.HTTPPort)
 	log.Info("Listen: http://%s", listenAddr)
 	if err := http.ListenAndServe(listenAddr, m); err != nil {
@@ -0,0 +1,63 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"time"
+)
+
+// CrawlFailure records failed background crawls of an import path,
+// which is not crawled in background again until NextRetry.
+type CrawlFailure struct {
+	ID         int64  `xorm:"pk autoincr"`
+	ImportPath string `xorm:"UNIQUE NOT NULL"`
+	NumFails   int
+	NextRetry  int64 `xorm:"INDEX"`
+}
+
+// notRetryingCond is the condition of import paths that are not waiting for retry.
+const notRetryingCond = "import_path NOT IN (SELECT import_path FROM crawl_failure WHERE next_retry>?)"
+
+// AddCrawlFailure records a failed crawl of given import path, it's retried
+// after given interval which doubles on every failure up to maxInterval.
+func AddCrawlFailure(importPath string, interval, maxInterval time.Duration) error {
+	f := &CrawlFailure{ImportPath: importPath}
+	has, err := x.Get(f)
+	if err != nil {
+		return err
+	}
+
+	f.NumFails++
+	for i := 1; i < f.NumFails && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	f.NextRetry = time.Now().UTC().Add(interval).Unix()
+
+	if has {
+		_, err = x.Id(f.ID).Cols("num_fails", "next_retry").Update(f)
+	} else {
+		_, err = x.Insert(f)
+	}
+	return err
+}
+
+// DeleteCrawlFailure removes record of failed crawls of given import path.
+func DeleteCrawlFailure(importPath string) error {
+	_, err := x.Delete(&CrawlFailure{ImportPath: importPath})
+	return err
+}
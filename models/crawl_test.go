@@ -0,0 +1,114 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddCrawlFailure(t *testing.T) {
+	defer newTestEngine(t)()
+
+	const importPath = "github.com/user/broken"
+	// Interval doubles on every failure until it reaches the maximum.
+	for i, expect := range []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 5 * time.Hour, 5 * time.Hour} {
+		start := time.Now().UTC()
+		if err := AddCrawlFailure(importPath, time.Hour, 5*time.Hour); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		f := &CrawlFailure{ImportPath: importPath}
+		if has, err := x.Get(f); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		} else if !has {
+			t.Fatalf("#%d: failure is not recorded", i)
+		}
+		if f.NumFails != i+1 {
+			t.Errorf("#%d: expect %d failures but got %d", i, i+1, f.NumFails)
+		}
+		min, max := start.Add(expect).Unix(), time.Now().UTC().Add(expect).Unix()
+		if f.NextRetry < min || f.NextRetry > max {
+			t.Errorf("#%d: expect next retry in %s but got %s", i, expect,
+				time.Unix(f.NextRetry, 0).Sub(start))
+		}
+	}
+
+	if n, err := x.Count(new(CrawlFailure)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("expect 1 record but got %d", n)
+	}
+
+	if err := DeleteCrawlFailure(importPath); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := x.Get(&CrawlFailure{ImportPath: importPath}); err != nil {
+		t.Fatal(err)
+	} else if has {
+		t.Error("failure is not deleted")
+	}
+}
+
+func TestGetUnresolvedImportPaths(t *testing.T) {
+	defer newTestEngine(t)()
+
+	if _, err := x.Insert([]*PkgImport{
+		{PkgID: 1, ImportPath: "github.com/user/popular"},
+		{PkgID: 2, ImportPath: "github.com/user/popular"},
+		{PkgID: 3, ImportPath: "github.com/user/popular"},
+		{PkgID: 1, ImportPath: "github.com/user/broken"},
+		{PkgID: 2, ImportPath: "github.com/user/broken"},
+		{PkgID: 1, ImportPath: "github.com/user/retried"},
+		{PkgID: 1, ImportPath: "github.com/user/resolved", ImportID: 4},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := x.Insert([]*CrawlFailure{
+		{ImportPath: "github.com/user/broken", NumFails: 1, NextRetry: now.Add(time.Hour).Unix()},
+		{ImportPath: "github.com/user/retried", NumFails: 3, NextRetry: now.Add(-time.Hour).Unix()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(expect []string) {
+		paths, err := GetUnresolvedImportPaths(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(paths, expect) {
+			t.Errorf("expect %v but got %v", expect, paths)
+		}
+	}
+
+	// Import paths waiting for retry are excluded, others are ordered by number of importers.
+	check([]string{"github.com/user/popular", "github.com/user/retried"})
+
+	if err := DeleteCrawlFailure("github.com/user/broken"); err != nil {
+		t.Fatal(err)
+	}
+	check([]string{"github.com/user/popular", "github.com/user/broken", "github.com/user/retried"})
+
+	paths, err := GetUnresolvedImportPaths(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"github.com/user/popular"}) {
+		t.Errorf("expect only the most imported path but got %v", paths)
+	}
+}
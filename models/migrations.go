@@ -0,0 +1,131 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Unknwon/log"
+)
+
+// Version represents version of database schema.
+type Version struct {
+	ID      int64 `xorm:"pk autoincr"`
+	Version int64
+}
+
+// migrations are applied in order, version of database schema
+// is index of the migration plus one after it's applied.
+var migrations = []func() error{
+	migratePkgImports, // V0 -> V1
+	dropPkgJsNum,      // V1 -> V2
+}
+
+// migrate applies migrations that haven't been applied to database.
+func migrate() error {
+	if err := x.Sync(new(Version)); err != nil {
+		return fmt.Errorf("sync version: %v", err)
+	}
+
+	ver := &Version{ID: 1}
+	has, err := x.Get(ver)
+	if err != nil {
+		return fmt.Errorf("get version: %v", err)
+	} else if !has {
+		if _, err = x.InsertOne(ver); err != nil {
+			return fmt.Errorf("insert version: %v", err)
+		}
+	}
+
+	for i := ver.Version; i < int64(len(migrations)); i++ {
+		log.Info("Migrating database to version %d", i+1)
+		if err = migrations[i](); err != nil {
+			return fmt.Errorf("migrate to version %d: %v", i+1, err)
+		}
+		ver.Version = i + 1
+		if _, err = x.Id(ver.ID).Cols("version").Update(ver); err != nil {
+			return fmt.Errorf("update version: %v", err)
+		}
+	}
+	return nil
+}
+
+// migratePkgImports moves import relations from "$id|" encoded strings
+// of pkg_info and pkg_ref to pkg_import table.
+func migratePkgImports() error {
+	if _, err := x.Exec("DELETE FROM pkg_import"); err != nil {
+		return fmt.Errorf("clean pkg_import: %v", err)
+	}
+
+	// Import paths of every package are complete records of relations,
+	// resolved IDs in legacy columns are recomputed from them.
+	var lastID int64
+	for {
+		pkgs := make([]*PkgInfo, 0, 100)
+		if err := x.Cols("id", "import_paths", "is_go_repo").Where("version=?", "").
+			And("id>?", lastID).Asc("id").Limit(100).Find(&pkgs); err != nil {
+			return fmt.Errorf("find packages: %v", err)
+		} else if len(pkgs) == 0 {
+			break
+		}
+
+		imps := make([]*PkgImport, 0, len(pkgs)*5)
+		for _, pkg := range pkgs {
+			lastID = pkg.ID
+			if pkg.IsGoRepo {
+				continue
+			}
+
+			seen := make(map[string]bool)
+			for _, p := range strings.Split(pkg.ImportPaths, "|") {
+				if !isRecordableImport(p) || seen[p] {
+					continue
+				}
+				seen[p] = true
+				imps = append(imps, &PkgImport{
+					PkgID:      pkg.ID,
+					ImportPath: p,
+				})
+			}
+		}
+		if len(imps) > 0 {
+			if _, err := x.Insert(imps); err != nil {
+				return fmt.Errorf("insert import relations: %v", err)
+			}
+		}
+	}
+
+	if _, err := x.Exec("UPDATE pkg_import SET import_id=COALESCE((SELECT id FROM pkg_info WHERE pkg_info.import_path=pkg_import.import_path AND pkg_info.version=''), 0)"); err != nil {
+		return fmt.Errorf("link import relations: %v", err)
+	}
+	if _, err := x.Exec("UPDATE pkg_info SET ref_num=(SELECT COUNT(*) FROM pkg_import WHERE pkg_import.import_id=pkg_info.id)"); err != nil {
+		return fmt.Errorf("update reference numbers: %v", err)
+	}
+
+	// Errors are ignored because legacy columns and table may not exist.
+	x.Exec("ALTER TABLE pkg_info DROP COLUMN import_ids")
+	x.Exec("ALTER TABLE pkg_info DROP COLUMN ref_ids")
+	x.Exec("DROP TABLE pkg_ref")
+	return nil
+}
+
+// dropPkgJsNum drops number of JS files column of pkg_info,
+// documentation is now saved as single HTML file.
+func dropPkgJsNum() error {
+	// Error is ignored because column may not exist.
+	x.Exec("ALTER TABLE pkg_info DROP COLUMN js_num")
+	return nil
+}
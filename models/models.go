@@ -16,40 +16,101 @@ package models
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"strings"
 
 	"github.com/Unknwon/log"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/go-xorm/core"
 	"github.com/go-xorm/xorm"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/robfig/cron"
 
 	"github.com/Unknwon/gowalker/modules/setting"
 )
 
-var x *xorm.Engine
+var (
+	x      *xorm.Engine
+	dbType string
+)
+
+// pqEscaper escapes values in single quotes of PostgreSQL connection string,
+// e.g. password may contain quotes and backslashes.
+var pqEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
 
-func init() {
+// newEngine creates a new engine based on database type in configuration.
+func newEngine() (*xorm.Engine, error) {
 	sec := setting.Cfg.Section("database")
+	dbType = sec.Key("TYPE").In("mysql", []string{"mysql", "postgres", "sqlite3"})
+
+	var connStr string
+	switch dbType {
+	case "mysql":
+		connStr = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8",
+			sec.Key("USER").String(),
+			sec.Key("PASSWD").String(),
+			sec.Key("HOST").String(),
+			sec.Key("NAME").String())
+	case "postgres":
+		host, port := sec.Key("HOST").String(), "5432"
+		if i := strings.LastIndex(host, ":"); i > -1 {
+			host, port = host[:i], host[i+1:]
+		}
+		connStr = fmt.Sprintf("user='%s' password='%s' host='%s' port='%s' dbname='%s' sslmode='%s'",
+			pqEscaper.Replace(sec.Key("USER").String()),
+			pqEscaper.Replace(sec.Key("PASSWD").String()),
+			pqEscaper.Replace(host), pqEscaper.Replace(port),
+			pqEscaper.Replace(sec.Key("NAME").String()),
+			pqEscaper.Replace(sec.Key("SSL_MODE").MustString("disable")))
+	case "sqlite3":
+		connStr = sec.Key("PATH").MustString("data/gowalker.db")
+		if err := os.MkdirAll(path.Dir(connStr), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("create database directory: %v", err)
+		}
+		connStr = "file:" + connStr + "?cache=shared&mode=rwc"
+	}
+	return xorm.NewEngine(dbType, connStr)
+}
+
+// dropLegacyIndexes removes indexes that are no longer used by current schema,
+// errors are ignored because these indexes may not exist.
+func dropLegacyIndexes() {
+	// Import path is no longer unique since documentation is versioned.
+	const name = "UQE_pkg_info_import_path"
+	switch dbType {
+	case "mysql":
+		x.Exec("DROP INDEX `" + name + "` ON `pkg_info`")
+	default:
+		x.Exec(`DROP INDEX IF EXISTS "` + name + `"`)
+	}
+}
+
+// Init connects to database and syncs schema, it must be called after
+// settings are loaded.
+func Init() {
 	var err error
-	x, err = xorm.NewEngine("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8",
-		sec.Key("USER").String(),
-		sec.Key("PASSWD").String(),
-		sec.Key("HOST").String(),
-		sec.Key("NAME").String()))
+	x, err = newEngine()
 	if err != nil {
 		log.FatalD(4, "Fail to init new engine: %v", err)
 	}
 	x.SetLogger(nil)
 	x.SetMapper(core.GonicMapper{})
 
-	if err = x.Sync(new(PkgInfo), new(PkgRef)); err != nil {
+	dropLegacyIndexes()
+
+	if err = x.Sync(new(PkgInfo), new(PkgImport), new(PkgTerm), new(PkgExport), new(CrawlFailure)); err != nil {
 		log.FatalD(4, "Fail to sync database: %v", err)
 	}
+	if err = migrate(); err != nil {
+		log.FatalD(4, "Fail to migrate database: %v", err)
+	}
 
-	numTotalPackages, _ = x.Count(new(PkgInfo))
+	numTotalPackages, _ = x.Where("version=?", "").Count(new(PkgInfo))
 	c := cron.New()
 	c.AddFunc("@every 1m", func() {
-		numTotalPackages, _ = x.Count(new(PkgInfo))
+		numTotalPackages, _ = x.Where("version=?", "").Count(new(PkgInfo))
 	})
 	c.Start()
 }
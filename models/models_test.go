@@ -0,0 +1,54 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+)
+
+// newTestEngine replaces engine by one of a SQLite database in a temporary
+// directory with schema synced, returned function restores the original one.
+func newTestEngine(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "gw-models")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := xorm.NewEngine("sqlite3", "file:"+path.Join(dir, "test.db")+"?mode=rwc")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	e.SetLogger(nil)
+	e.SetMapper(core.GonicMapper{})
+	if err = e.Sync(new(PkgInfo), new(PkgImport), new(PkgTerm), new(PkgExport), new(CrawlFailure)); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	oldX, oldType := x, dbType
+	x, dbType = e, "sqlite3"
+	return func() {
+		x, dbType = oldX, oldType
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -15,14 +15,13 @@
 package models
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"path"
 	"strings"
 	"time"
 
-	"github.com/Unknwon/com"
+	"github.com/Unknwon/log"
 
 	"github.com/Unknwon/gowalker/modules/base"
 	"github.com/Unknwon/gowalker/modules/setting"
@@ -38,7 +37,8 @@ var (
 type PkgInfo struct {
 	ID         int64  `xorm:"pk autoincr"`
 	Name       string `xorm:"-"`
-	ImportPath string `xorm:"UNIQUE"`
+	ImportPath string `xorm:"UNIQUE(path_version)"`
+	Version    string `xorm:"UNIQUE(path_version)"` // Empty for default branch.
 	Etag       string
 
 	ProjectPath string
@@ -50,162 +50,75 @@ type PkgInfo struct {
 	IsGoRepo    bool
 	IsGoSubrepo bool
 	IsGaeRepo   bool
+	IsFork      bool
 
 	PkgVer int
 
 	Priority int `xorm:" NOT NULL"`
 	Views    int64
 	Stars    int64
-	// Indicate how many JS should be downloaded(JsNum=total num - 1)
-	JsNum int
 
 	ImportNum int64
-	ImportIDs string `xorm:"import_ids LONGTEXT"`
 	// Import num usually is small so save it to reduce a database query.
 	ImportPaths string `xorm:"LONGTEXT"`
 
+	// Relations are stored in PkgImport, this is for display only.
 	RefNum int64
-	RefIDs string `xorm:"ref_ids LONGTEXT"`
+
+	// Keys of snapshot, rendered documentation and README blobs in storage,
+	// README keys are in form of "<lang>:<key>|<lang>:<key>".
+	SnapshotKey string
+	DocKey      string
+	ReadmeKeys  string `xorm:"TEXT"`
 
 	Subdirs string `xorm:"TEXT"`
+	Tags    string `xorm:"TEXT"` // Known tags or module versions.
 
-	LastViewed int64 `xorm:"-"`
+	LastViewed int64  `xorm:"-"`
+	Anchor     string `xorm:"-"` // Matched identifier of search.
 	Created    int64
 }
 
-func (p *PkgInfo) JSPath() string {
-	return path.Join(setting.DocsJsPath, p.ImportPath) + ".js"
-}
-
-// CanRefresh returns true if package is available to refresh.
-func (p *PkgInfo) CanRefresh() bool {
-	return time.Now().UTC().Add(-1*setting.RefreshInterval).Unix() > p.Created
-}
-
-// GetRefs returns a list of packages that import this one.
-func (p *PkgInfo) GetRefs() []*PkgInfo {
-	pinfos := make([]*PkgInfo, 0, p.RefNum)
-	refIDs := strings.Split(p.RefIDs, "|")
-	for i := range refIDs {
-		if len(refIDs[i]) == 0 {
-			continue
-		}
-
-		id := com.StrTo(refIDs[i][1:]).MustInt64()
-		if pinfo, _ := GetPkgInfoById(id); pinfo != nil {
-			pinfo.Name = path.Base(pinfo.ImportPath)
-			pinfos = append(pinfos, pinfo)
-		}
+// DocPath returns import path with version suffix if it's not default branch.
+func (p *PkgInfo) DocPath() string {
+	if len(p.Version) == 0 {
+		return p.ImportPath
 	}
-	return pinfos
+	return p.ImportPath + "@" + p.Version
 }
 
-// PACKAGE_VER is modified when previously stored packages are invalid.
-const PACKAGE_VER = 1
-
-// PkgRef represents temporary reference information of a package.
-type PkgRef struct {
-	ID         int64  `xorm:"pk autoincr"`
-	ImportPath string `xorm:"UNIQUE"`
-	RefNum     int64
-	RefIDs     string `xorm:"ref_ids LONGTEXT"`
-}
-
-func updatePkgRef(pid int64, refPath string) error {
-	if base.IsGoRepoPath(refPath) ||
-		refPath == "C" ||
-		refPath[1] == '.' ||
-		!base.IsValidRemotePath(refPath) {
-		return nil
-	}
-
-	ref := new(PkgRef)
-	has, err := x.Where("import_path=?", refPath).Get(ref)
-	if err != nil {
-		return fmt.Errorf("get PkgRef: %v", err)
-	}
-
-	queryStr := "$" + com.ToStr(pid) + "|"
-	if !has {
-		if _, err = x.Insert(&PkgRef{
-			ImportPath: refPath,
-			RefNum:     1,
-			RefIDs:     queryStr,
-		}); err != nil {
-			return fmt.Errorf("insert PkgRef: %v", err)
+// ReadmeKey returns key of README blob of given language,
+// it returns empty string if not found.
+func (p *PkgInfo) ReadmeKey(lang string) string {
+	for _, pair := range strings.Split(p.ReadmeKeys, "|") {
+		if strings.HasPrefix(pair, lang+":") {
+			return pair[len(lang)+1:]
 		}
-		return nil
-	}
-
-	i := strings.Index(ref.RefIDs, queryStr)
-	if i > -1 {
-		return nil
 	}
-
-	ref.RefIDs += queryStr
-	ref.RefNum++
-	_, err = x.Id(ref.ID).AllCols().Update(ref)
-	return err
+	return ""
 }
 
-// checkRefs checks if given packages are still referencing this one.
-func checkRefs(pinfo *PkgInfo) {
-	var buf bytes.Buffer
-	pinfo.RefNum = 0
-	refIDs := strings.Split(pinfo.RefIDs, "|")
-	for i := range refIDs {
-		if len(refIDs[i]) == 0 {
-			continue
-		}
-
-		fmt.Println(com.StrTo(refIDs[i][1:]).MustInt64())
-		pkg, _ := GetPkgInfoById(com.StrTo(refIDs[i][1:]).MustInt64())
-		if pkg == nil {
-			continue
-		}
-
-		if strings.Index(pkg.ImportIDs, "$"+com.ToStr(pinfo.ID)+"|") == -1 {
-			continue
-		}
-
-		buf.WriteString("$")
-		buf.WriteString(com.ToStr(pkg.ID))
-		buf.WriteString("|")
-		pinfo.RefNum++
-	}
-	pinfo.RefIDs = buf.String()
+// CanRefresh returns true if package is available to refresh.
+func (p *PkgInfo) CanRefresh() bool {
+	return time.Now().UTC().Add(-1*setting.RefreshInterval).Unix() > p.Created
 }
 
-// updateRef updates or crates corresponding reference import information.
-func updateRef(pid int64, refPath string) (int64, error) {
-	if len(refPath) == 0 {
-		return 0, nil
-	}
-
-	pinfo, err := GetPkgInfo(refPath)
-	if err != nil && pinfo == nil {
-		if err == ErrPackageNotFound ||
-			err == ErrPackageVersionTooOld {
-			// Package hasn't existed yet, save to temporary place.
-			return 0, updatePkgRef(pid, refPath)
-		}
-		return 0, fmt.Errorf("GetPkgInfo(%s): %v", refPath, err)
+// GetRefs returns at most limit packages that import this one, most starred first.
+func (p *PkgInfo) GetRefs(limit int) []*PkgInfo {
+	pinfos := make([]*PkgInfo, 0, limit)
+	if err := x.Where("id IN (SELECT pkg_id FROM pkg_import WHERE import_id=?)", p.ID).
+		Desc("stars").Limit(limit).Find(&pinfos); err != nil {
+		log.Error("GetRefs (%s): %v", p.ImportPath, err)
 	}
-
-	// Check if reference information has beed recorded.
-	queryStr := "$" + com.ToStr(pid) + "|"
-	i := strings.Index(pinfo.RefIDs, queryStr)
-	if i > -1 {
-		return pinfo.ID, nil
+	for _, pinfo := range pinfos {
+		pinfo.Name = path.Base(pinfo.ImportPath)
 	}
-
-	// Add new as needed.
-	pinfo.RefIDs += queryStr
-	pinfo.RefNum++
-	_, err = x.Id(pinfo.ID).AllCols().Update(pinfo)
-	return pinfo.ID, err
+	return pinfos
 }
 
+// PACKAGE_VER is modified when previously stored packages are invalid.
+const PACKAGE_VER = 2
+
 // SavePkgInfo saves package information.
 func SavePkgInfo(pinfo *PkgInfo, updateRefs bool) (err error) {
 	if len(pinfo.Synopsis) > 255 {
@@ -223,77 +136,66 @@ func SavePkgInfo(pinfo *PkgInfo, updateRefs bool) (err error) {
 		pinfo.Priority = 99
 	}
 
-	// When package is not created, there is no ID so check will certainly fail.
-	var ignoreCheckRefs bool
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sess.Rollback()
+		}
+	}()
 
 	// Create or update package info itself.
 	// Note(Unknwon): do this because we need ID field later.
-	if pinfo.ID == 0 {
-		ignoreCheckRefs = true
+	isNew := pinfo.ID == 0
+	if isNew {
 		pinfo.Views = 1
+		if _, err = sess.Insert(pinfo); err != nil {
+			return fmt.Errorf("insert package info: %v", err)
+		}
+	}
 
-		// First time created, check PkgRef.
-		ref := new(PkgRef)
-		has, err := x.Where("import_path=?", pinfo.ImportPath).Get(ref)
-		if err != nil {
-			return fmt.Errorf("get PkgRef: %v", err)
-		} else if has {
-			pinfo.RefNum = ref.RefNum
-			pinfo.RefIDs = ref.RefIDs
-			if _, err = x.Id(ref.ID).Delete(ref); err != nil {
-				return fmt.Errorf("delete PkgRef: %v", err)
+	// References are only recorded for default branch.
+	if len(pinfo.Version) == 0 {
+		if isNew {
+			if err = resolvePkgImports(sess, pinfo); err != nil {
+				return err
 			}
 		}
-
-		_, err = x.Insert(pinfo)
-	} else {
-		_, err = x.Id(pinfo.ID).AllCols().Update(pinfo)
+		if pinfo.RefNum, err = sess.Where("import_id=?", pinfo.ID).Count(new(PkgImport)); err != nil {
+			return fmt.Errorf("count references: %v", err)
+		}
 	}
-	if err != nil {
+
+	if _, err = sess.Id(pinfo.ID).AllCols().Update(pinfo); err != nil {
 		return fmt.Errorf("update package info: %v", err)
 	}
 
 	// Update package import references.
-	// Note(Unknwon): I just don't see the value of who imports STD
-	//	when you don't even import and uses what objects.
 	if updateRefs && !pinfo.IsGoRepo {
-		var buf bytes.Buffer
-		paths := strings.Split(pinfo.ImportPaths, "|")
-		for i := range paths {
-			if base.IsGoRepoPath(paths[i]) {
-				continue
-			}
-
-			refID, err := updateRef(pinfo.ID, paths[i])
-			if err != nil {
-				return fmt.Errorf("updateRef: %v", err)
-			} else if refID == 0 {
-				continue
-			}
-			buf.WriteString("$")
-			buf.WriteString(com.ToStr(refID))
-			buf.WriteString("|")
+		if err = replacePkgImports(sess, pinfo); err != nil {
+			return err
 		}
-		pinfo.ImportIDs = buf.String()
-
-		if !ignoreCheckRefs {
-			// Check packages who import this is still importing.
-			checkRefs(pinfo)
-		}
-		_, err = x.Id(pinfo.ID).AllCols().Update(pinfo)
-		return err
 	}
-	return nil
+
+	return sess.Commit()
 }
 
-// GetPkgInfo returns package information by given import path.
+// GetPkgInfo returns package information of default branch by given import path.
 func GetPkgInfo(importPath string) (*PkgInfo, error) {
+	return GetVersionPkgInfo(importPath, "")
+}
+
+// GetVersionPkgInfo returns package information by given import path and version.
+func GetVersionPkgInfo(importPath, version string) (*PkgInfo, error) {
 	if len(importPath) == 0 {
 		return nil, ErrEmptyPackagePath
 	}
 
 	pinfo := new(PkgInfo)
-	has, err := x.Where("import_path=?", importPath).Get(pinfo)
+	has, err := x.Where("import_path=?", importPath).And("version=?", version).Get(pinfo)
 	if err != nil {
 		return nil, err
 	} else if !has {
@@ -303,7 +205,7 @@ func GetPkgInfo(importPath string) (*PkgInfo, error) {
 		return pinfo, ErrPackageVersionTooOld
 	}
 
-	if !com.IsFile(pinfo.JSPath()) {
+	if len(pinfo.DocKey) == 0 {
 		pinfo.Etag = ""
 		return pinfo, ErrPackageVersionTooOld
 	}
@@ -311,8 +213,8 @@ func GetPkgInfo(importPath string) (*PkgInfo, error) {
 	return pinfo, nil
 }
 
-// GetSubPkgs returns sub-projects by given sub-directories.
-func GetSubPkgs(importPath string, dirs []string) []*PkgInfo {
+// GetSubPkgs returns sub-projects of given version by given sub-directories.
+func GetSubPkgs(importPath, version string, dirs []string) []*PkgInfo {
 	pinfos := make([]*PkgInfo, 0, len(dirs))
 	for _, dir := range dirs {
 		if len(dir) == 0 {
@@ -320,13 +222,14 @@ func GetSubPkgs(importPath string, dirs []string) []*PkgInfo {
 		}
 
 		fullPath := importPath + "/" + dir
-		if pinfo, err := GetPkgInfo(fullPath); err == nil {
+		if pinfo, err := GetVersionPkgInfo(fullPath, version); err == nil {
 			pinfo.Name = dir
 			pinfos = append(pinfos, pinfo)
 		} else {
 			pinfos = append(pinfos, &PkgInfo{
 				Name:       dir,
 				ImportPath: fullPath,
+				Version:    version,
 			})
 		}
 	}
@@ -366,7 +269,7 @@ func GetPkgInfoById(id int64) (*PkgInfo, error) {
 		return pinfo, ErrPackageVersionTooOld
 	}
 
-	if !com.IsFile(pinfo.JSPath()) {
+	if len(pinfo.DocKey) == 0 {
 		return pinfo, ErrPackageVersionTooOld
 	}
 
@@ -383,33 +286,115 @@ func GetPkgInfosByIDs(ids []int64) ([]*PkgInfo, error) {
 	return pkgInfos, x.Where("id > 0").In("id", base.Int64sToStrings(ids)).Find(&pkgInfos)
 }
 
-func getRepos(trueCondition string) ([]*PkgInfo, error) {
-	pkgs := make([]*PkgInfo, 0, 100)
-	return pkgs, x.Desc("views").Where(trueCondition+"=?", true).Find(&pkgs)
+// GetStalePkgInfos returns packages of default branch that haven't been refreshed
+// for given duration, ordered by priority and views. Packages waiting for retry
+// after failed crawls are excluded.
+func GetStalePkgInfos(limit int, interval time.Duration) ([]*PkgInfo, error) {
+	now := time.Now().UTC()
+	pkgs := make([]*PkgInfo, 0, limit)
+	return pkgs, x.Limit(limit).Desc("priority").Desc("views").
+		Where("version=?", "").And("created<?", now.Add(-interval).Unix()).
+		And(notRetryingCond, now.Unix()).Find(&pkgs)
 }
 
-func GetGoRepos() ([]*PkgInfo, error) {
-	return getRepos("is_go_repo")
+// ResetPkgDocKey clears key of documentation blob of given package,
+// so it's treated as outdated and generated again.
+func ResetPkgDocKey(id int64) error {
+	_, err := x.Id(id).Cols("doc_key").Update(new(PkgInfo))
+	return err
 }
 
-func GetGoSubepos() ([]*PkgInfo, error) {
-	return getRepos("is_go_subrepo")
+// ResetPkgSnapshotKey clears key of snapshot of given package,
+// so it's crawled again even if it's not modified.
+func ResetPkgSnapshotKey(id int64) error {
+	_, err := x.Id(id).Cols("snapshot_key").Update(new(PkgInfo))
+	return err
 }
 
-func GetGAERepos() ([]*PkgInfo, error) {
-	return getRepos("is_gae_repo")
+// UpdatePkgDocKeys updates keys of rendered documentation and README blobs of given package.
+func UpdatePkgDocKeys(pinfo *PkgInfo) error {
+	_, err := x.Id(pinfo.ID).Cols("doc_key", "readme_keys").Update(pinfo)
+	return err
 }
 
-// SearchPkgInfo searches package information by given keyword.
-func SearchPkgInfo(limit int, keyword string) ([]*PkgInfo, error) {
-	if len(keyword) == 0 {
-		return nil, nil
-	}
+// GetSnapshotPkgInfos returns a list of packages that have snapshot
+// and ID greater than given one, ordered by ID.
+func GetSnapshotPkgInfos(afterID int64, limit int) ([]*PkgInfo, error) {
 	pkgs := make([]*PkgInfo, 0, limit)
-	return pkgs, x.Limit(limit).Desc("priority").Desc("stars").Desc("views").Where("import_path like ?", "%"+keyword+"%").Find(&pkgs)
+	return pkgs, x.Where("id>?", afterID).And("snapshot_key<>?", "").Asc("id").Limit(limit).Find(&pkgs)
 }
 
-func DeletePackageByPath(importPath string) error {
-	_, err := x.Delete(&PkgInfo{ImportPath: importPath})
-	return err
+// GetBlobKeys returns keys of all blobs in storage that are used by packages.
+func GetBlobKeys() (map[string]bool, error) {
+	keys := make(map[string]bool)
+	var lastID int64
+	for {
+		pkgs := make([]*PkgInfo, 0, 100)
+		if err := x.Cols("id", "snapshot_key", "doc_key", "readme_keys").Where("id>?", lastID).
+			Asc("id").Limit(100).Find(&pkgs); err != nil {
+			return nil, err
+		} else if len(pkgs) == 0 {
+			break
+		}
+
+		for _, pkg := range pkgs {
+			lastID = pkg.ID
+			if len(pkg.SnapshotKey) > 0 {
+				keys[pkg.SnapshotKey] = true
+			}
+			if len(pkg.DocKey) > 0 {
+				keys[pkg.DocKey] = true
+			}
+			for _, pair := range strings.Split(pkg.ReadmeKeys, "|") {
+				if i := strings.Index(pair, ":"); i > -1 {
+					keys[pair[i+1:]] = true
+				}
+			}
+		}
+	}
+	return keys, nil
+}
+
+// DeletePackageByPath deletes package by given doc path in form of "<import path>@<version>",
+// all versions are deleted if version is empty since the package no longer exists.
+func DeletePackageByPath(docPath string) (err error) {
+	importPath, version := base.ParseDocPath(docPath)
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sess.Rollback()
+		}
+	}()
+
+	if len(version) > 0 {
+		// Versioned documentation has no references or index.
+		if _, err = sess.Delete(&PkgInfo{ImportPath: importPath, Version: version}); err != nil {
+			return err
+		}
+		return sess.Commit()
+	}
+
+	pinfo := new(PkgInfo)
+	has, err := sess.Where("import_path=?", importPath).And("version=?", "").Get(pinfo)
+	if err != nil {
+		return err
+	} else if has {
+		if err = deletePkgImports(sess, pinfo.ID); err != nil {
+			return err
+		}
+		if _, err = sess.Delete(&PkgTerm{PkgID: pinfo.ID}); err != nil {
+			return err
+		} else if _, err = sess.Delete(&PkgExport{PkgID: pinfo.ID}); err != nil {
+			return err
+		}
+	}
+
+	if _, err = sess.Delete(&PkgInfo{ImportPath: importPath}); err != nil {
+		return err
+	}
+	return sess.Commit()
 }
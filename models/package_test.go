@@ -0,0 +1,111 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"testing"
+)
+
+func TestDeletePackageByPath(t *testing.T) {
+	defer newTestEngine(t)()
+
+	const importPath = "github.com/user/pkg"
+	for _, version := range []string{"", "v1.0.0", "v2.0.0"} {
+		pinfo := &PkgInfo{
+			ImportPath:  importPath,
+			Version:     version,
+			ImportNum:   1,
+			ImportPaths: "github.com/user/dep",
+		}
+		if err := SavePkgInfo(pinfo, len(version) == 0); err != nil {
+			t.Fatalf("%s: %v", version, err)
+		}
+		if len(version) == 0 {
+			if err := SavePkgIndex(pinfo.ID, []*PkgTerm{{Term: "pkg"}}, []*PkgExport{{Name: "Hello"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	count := func(bean interface{}) int64 {
+		n, err := x.Count(bean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	check := func(versions []string, numRelated int64) {
+		if n := count(&PkgInfo{ImportPath: importPath}); n != int64(len(versions)) {
+			t.Errorf("expect %d versions but got %d", len(versions), n)
+		}
+		for _, version := range versions {
+			if n, err := x.Where("import_path=? AND version=?", importPath, version).Count(new(PkgInfo)); err != nil {
+				t.Fatal(err)
+			} else if n != 1 {
+				t.Errorf("%q: expect 1 version but got %d", version, n)
+			}
+		}
+		for name, bean := range map[string]interface{}{
+			"imports": new(PkgImport),
+			"terms":   new(PkgTerm),
+			"exports": new(PkgExport),
+		} {
+			if n := count(bean); n != numRelated {
+				t.Errorf("expect %d %s but got %d", numRelated, name, n)
+			}
+		}
+	}
+	check([]string{"", "v1.0.0", "v2.0.0"}, 1)
+
+	// Only given version is deleted, default branch keeps its relations.
+	if err := DeletePackageByPath(importPath + "@v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	check([]string{"", "v2.0.0"}, 1)
+
+	// Every version is deleted without version.
+	if err := DeletePackageByPath(importPath); err != nil {
+		t.Fatal(err)
+	}
+	check(nil, 0)
+}
+
+func TestGetRefs(t *testing.T) {
+	defer newTestEngine(t)()
+
+	pinfo := &PkgInfo{ImportPath: "github.com/user/lib"}
+	if err := SavePkgInfo(pinfo, true); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		if err := SavePkgInfo(&PkgInfo{
+			ImportPath:  "github.com/user/" + name,
+			Stars:       int64(i),
+			ImportNum:   1,
+			ImportPaths: pinfo.ImportPath,
+		}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only most starred importers are returned.
+	refs := pinfo.GetRefs(2)
+	if len(refs) != 2 || refs[0].ImportPath != "github.com/user/c" || refs[1].ImportPath != "github.com/user/b" {
+		t.Errorf("unexpected references: %v", refs)
+	}
+	if refs = pinfo.GetRefs(10); len(refs) != 3 {
+		t.Errorf("expect 3 references but got %d", len(refs))
+	}
+}
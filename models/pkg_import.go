@@ -0,0 +1,157 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"github.com/Unknwon/gowalker/modules/base"
+)
+
+// PkgImport represents an import relation from a package to the one it imports.
+// ImportID is zero when the imported package hasn't been generated yet,
+// and it is filled once that package is saved for the first time.
+type PkgImport struct {
+	ID         int64  `xorm:"pk autoincr"`
+	PkgID      int64  `xorm:"UNIQUE(s) NOT NULL"`
+	ImportPath string `xorm:"UNIQUE(s) INDEX NOT NULL"`
+	ImportID   int64  `xorm:"INDEX"`
+}
+
+// isRecordableImport returns true if given import path should be recorded,
+// standard library is excluded because knowing who imports it is of no value.
+func isRecordableImport(importPath string) bool {
+	return len(importPath) > 1 &&
+		importPath != "C" &&
+		importPath[1] != '.' &&
+		!base.IsGoRepoPath(importPath) &&
+		base.IsValidRemotePath(importPath)
+}
+
+// updateRefNums recounts references of packages with given IDs.
+func updateRefNums(sess *xorm.Session, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := sess.Exec("UPDATE pkg_info SET ref_num=(SELECT COUNT(*) FROM pkg_import WHERE pkg_import.import_id=pkg_info.id) WHERE id IN (" +
+		strings.Join(base.Int64sToStrings(ids), ",") + ")")
+	return err
+}
+
+// resolvePkgImports links import relations waiting for given package,
+// which is only called when package is created.
+func resolvePkgImports(sess *xorm.Session, pinfo *PkgInfo) (err error) {
+	if _, err = sess.Exec("UPDATE pkg_import SET import_id=? WHERE import_path=? AND import_id=0",
+		pinfo.ID, pinfo.ImportPath); err != nil {
+		return fmt.Errorf("link import relations: %v", err)
+	}
+	return nil
+}
+
+// replacePkgImports replaces import relations of given package by its import paths,
+// and recounts references of packages that it used to or now imports.
+func replacePkgImports(sess *xorm.Session, pinfo *PkgInfo) error {
+	olds := make([]*PkgImport, 0, pinfo.ImportNum)
+	if err := sess.Where("pkg_id=?", pinfo.ID).Find(&olds); err != nil {
+		return fmt.Errorf("find old import relations: %v", err)
+	}
+	affected := make([]int64, 0, len(olds))
+	for _, imp := range olds {
+		if imp.ImportID > 0 {
+			affected = append(affected, imp.ImportID)
+		}
+	}
+
+	if len(olds) > 0 {
+		if _, err := sess.Delete(&PkgImport{PkgID: pinfo.ID}); err != nil {
+			return fmt.Errorf("delete old import relations: %v", err)
+		}
+	}
+
+	paths := make([]string, 0, pinfo.ImportNum)
+	for _, p := range strings.Split(pinfo.ImportPaths, "|") {
+		if isRecordableImport(p) {
+			paths = append(paths, p)
+		}
+	}
+
+	if len(paths) > 0 {
+		pkgs := make([]*PkgInfo, 0, len(paths))
+		if err := sess.Cols("id", "import_path").Where("version=?", "").In("import_path", paths).Find(&pkgs); err != nil {
+			return fmt.Errorf("find imported packages: %v", err)
+		}
+		ids := make(map[string]int64, len(pkgs))
+		for _, pkg := range pkgs {
+			ids[pkg.ImportPath] = pkg.ID
+		}
+
+		imps := make([]*PkgImport, len(paths))
+		for i, p := range paths {
+			imps[i] = &PkgImport{
+				PkgID:      pinfo.ID,
+				ImportPath: p,
+				ImportID:   ids[p],
+			}
+			if ids[p] > 0 {
+				affected = append(affected, ids[p])
+			}
+		}
+		if _, err := sess.Insert(imps); err != nil {
+			return fmt.Errorf("insert import relations: %v", err)
+		}
+	}
+
+	if err := updateRefNums(sess, affected); err != nil {
+		return fmt.Errorf("update reference numbers: %v", err)
+	}
+	return nil
+}
+
+// deletePkgImports deletes import relations of given package,
+// and unlinks relations of packages import it.
+func deletePkgImports(sess *xorm.Session, pid int64) (err error) {
+	if _, err = sess.Exec("UPDATE pkg_import SET import_id=0 WHERE import_id=?", pid); err != nil {
+		return fmt.Errorf("unlink import relations: %v", err)
+	}
+
+	pinfo := &PkgInfo{ID: pid}
+	if err = replacePkgImports(sess, pinfo); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUnresolvedImportPaths returns import paths that are imported by generated
+// packages but haven't been generated yet, ordered by number of importers.
+// Import paths waiting for retry after failed crawls are excluded.
+func GetUnresolvedImportPaths(limit int) ([]string, error) {
+	results, err := x.Query("SELECT import_path, COUNT(*) AS num FROM pkg_import WHERE import_id=0 AND "+notRetryingCond+
+		" GROUP BY import_path ORDER BY num DESC LIMIT "+strconv.Itoa(limit), time.Now().UTC().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(results))
+	for i := range results {
+		paths[i] = string(results[i]["import_path"])
+	}
+	return paths, nil
+}
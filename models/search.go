@@ -0,0 +1,328 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Unknwon/gowalker/modules/base"
+)
+
+// Weights of terms from different sources.
+const (
+	TERM_WEIGHT_DOC        = 1
+	TERM_WEIGHT_SUB_IDENT  = 2 // Part of a camel case identifier.
+	TERM_WEIGHT_SYNOPSIS   = 3
+	TERM_WEIGHT_PATH       = 5
+	TERM_WEIGHT_IDENT      = 8
+	TERM_WEIGHT_EXACT_NAME = 10 // Package name.
+)
+
+// PkgTerm represents an entry of inverted index from a term to a package,
+// Anchor is the identifier in documentation page where the term comes from.
+type PkgTerm struct {
+	ID     int64  `xorm:"pk autoincr"`
+	Term   string `xorm:"INDEX NOT NULL"`
+	PkgID  int64  `xorm:"INDEX NOT NULL"`
+	Anchor string
+	Weight int
+}
+
+// PkgExport represents an exported object of a package for semantic search.
+type PkgExport struct {
+	ID         int64  `xorm:"pk autoincr"`
+	PkgID      int64  `xorm:"INDEX NOT NULL"`
+	Name       string `xorm:"INDEX NOT NULL"` // Lower-cased name of object.
+	Anchor     string // Methods are in form of "Type_Method".
+	Desc       string // Beginning of documentation.
+	ImportPath string `xorm:"-"`
+}
+
+// SplitTerms splits text into lower-cased terms by non-alphanumeric characters.
+func SplitTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// SavePkgIndex replaces inverted index entries and exported objects of given package.
+func SavePkgIndex(pid int64, terms []*PkgTerm, exports []*PkgExport) (err error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sess.Rollback()
+		}
+	}()
+
+	if _, err = sess.Delete(&PkgTerm{PkgID: pid}); err != nil {
+		return fmt.Errorf("delete old terms: %v", err)
+	} else if _, err = sess.Delete(&PkgExport{PkgID: pid}); err != nil {
+		return fmt.Errorf("delete old exports: %v", err)
+	}
+
+	// Insert in batches to avoid exceeding limit of placeholders.
+	for i := range terms {
+		terms[i].PkgID = pid
+	}
+	for i := 0; i < len(terms); i += 100 {
+		end := i + 100
+		if end > len(terms) {
+			end = len(terms)
+		}
+		if _, err = sess.Insert(terms[i:end]); err != nil {
+			return fmt.Errorf("insert terms: %v", err)
+		}
+	}
+
+	for i := range exports {
+		exports[i].PkgID = pid
+	}
+	for i := 0; i < len(exports); i += 100 {
+		end := i + 100
+		if end > len(exports) {
+			end = len(exports)
+		}
+		if _, err = sess.Insert(exports[i:end]); err != nil {
+			return fmt.Errorf("insert exports: %v", err)
+		}
+	}
+	return sess.Commit()
+}
+
+type scoredPkgInfo struct {
+	*PkgInfo
+	score int
+}
+
+type scoredPkgInfos []*scoredPkgInfo
+
+func (s scoredPkgInfos) Len() int      { return len(s) }
+func (s scoredPkgInfos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s scoredPkgInfos) Less(i, j int) bool {
+	switch {
+	case s[i].score != s[j].score:
+		return s[i].score > s[j].score
+	case s[i].Priority != s[j].Priority:
+		return s[i].Priority > s[j].Priority
+	case s[i].Stars != s[j].Stars:
+		return s[i].Stars > s[j].Stars
+	}
+	return s[i].Views > s[j].Views
+}
+
+type scoredPkgExport struct {
+	*PkgExport
+	pkg *scoredPkgInfo
+}
+
+type scoredPkgExports []*scoredPkgExport
+
+func (s scoredPkgExports) Len() int           { return len(s) }
+func (s scoredPkgExports) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s scoredPkgExports) Less(i, j int) bool { return scoredPkgInfos{s[i].pkg, s[j].pkg}.Less(0, 1) }
+
+// searchPkgTerms searches inverted index for packages that match all terms,
+// the anchor of package is set to the identifier weighs most.
+func searchPkgTerms(limit int, terms []string, opts *SearchOptions) ([]*PkgInfo, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Only check top entries of each term for common ones can be matched by too many packages.
+	entries := make([]*PkgTerm, 0, 100)
+	for _, t := range terms {
+		es := make([]*PkgTerm, 0, 100)
+		if err := x.Where("term=?", t).Desc("weight").Limit(1000).Find(&es); err != nil {
+			return nil, fmt.Errorf("find term '%s': %v", t, err)
+		}
+		entries = append(entries, es...)
+	}
+
+	type match struct {
+		terms  map[string]bool
+		score  int
+		anchor string
+		weight int
+	}
+	matches := make(map[int64]*match)
+	for _, e := range entries {
+		m := matches[e.PkgID]
+		if m == nil {
+			m = &match{terms: make(map[string]bool)}
+			matches[e.PkgID] = m
+		}
+		m.terms[e.Term] = true
+		m.score += e.Weight
+		if len(e.Anchor) > 0 && e.Weight > m.weight {
+			m.anchor, m.weight = e.Anchor, e.Weight
+		}
+	}
+
+	ids := make([]int64, 0, len(matches))
+	for id, m := range matches {
+		if len(m.terms) == len(terms) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	pinfos := make([]*PkgInfo, 0, len(ids))
+	if err := opts.apply(x.Where("id > 0").In("id", base.Int64sToStrings(ids))).Find(&pinfos); err != nil {
+		return nil, fmt.Errorf("find packages: %v", err)
+	}
+
+	scored := make(scoredPkgInfos, len(pinfos))
+	for i, pinfo := range pinfos {
+		m := matches[pinfo.ID]
+		pinfo.Anchor = m.anchor
+		scored[i] = &scoredPkgInfo{pinfo, m.score}
+	}
+	sort.Sort(scored)
+
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	pinfos = make([]*PkgInfo, len(scored))
+	for i := range scored {
+		pinfos[i] = scored[i].PkgInfo
+	}
+	return pinfos, nil
+}
+
+// SearchPkgInfo searches package information by given options. Packages found by
+// inverted index come first and then those match import path. All packages
+// match filters are listed by priority when there is no keyword.
+func SearchPkgInfo(limit int, opts *SearchOptions) ([]*PkgInfo, error) {
+	if len(opts.Keyword) == 0 {
+		if !opts.HasFilters() {
+			return nil, nil
+		}
+		pkgs := make([]*PkgInfo, 0, limit)
+		return pkgs, opts.apply(x.Limit(limit).Desc("priority").Desc("stars").Desc("views").
+			Where("version=?", "")).Find(&pkgs)
+	}
+
+	terms := make([]string, 0, 3)
+	seen := make(map[string]bool)
+	for _, t := range SplitTerms(opts.Keyword) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	pinfos, err := searchPkgTerms(limit, terms, opts)
+	if err != nil {
+		return nil, err
+	} else if len(pinfos) >= limit {
+		return pinfos, nil
+	}
+
+	pkgs := make([]*PkgInfo, 0, limit)
+	if err = opts.apply(x.Limit(limit).Desc("priority").Desc("stars").Desc("views").
+		Where("LOWER(import_path) LIKE ?"+likeEscapeClause, "%"+likeEscaper.Replace(strings.ToLower(opts.Keyword))+"%").
+		And("version=?", "")).Find(&pkgs); err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]bool, len(pinfos))
+	for _, pinfo := range pinfos {
+		found[pinfo.ID] = true
+	}
+	for _, pkg := range pkgs {
+		if len(pinfos) >= limit {
+			break
+		} else if !found[pkg.ID] {
+			pinfos = append(pinfos, pkg)
+		}
+	}
+	return pinfos, nil
+}
+
+// SearchPkgExports searches exported objects by given query, which is name of
+// an object and optionally prefixed by package or type name, e.g. "time.ParseDuration".
+func SearchPkgExports(limit int, query string) ([]*PkgExport, error) {
+	words := SplitTerms(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	name := words[len(words)-1]
+	var prefix string
+	if len(words) > 1 {
+		prefix = words[len(words)-2]
+	}
+
+	// Common names like "New" are exported by many packages, candidates are taken
+	// from popular packages first so they are not cut off by the limit.
+	exports := make([]*PkgExport, 0, 100)
+	if err := x.Join("INNER", "pkg_info", "pkg_info.id = pkg_export.pkg_id").
+		Where("pkg_export.name=?", name).
+		Desc("pkg_info.priority").Desc("pkg_info.stars").Desc("pkg_info.views").
+		Limit(1000).Find(&exports); err != nil {
+		return nil, fmt.Errorf("find exports: %v", err)
+	}
+
+	ids := make([]int64, 0, len(exports))
+	for _, e := range exports {
+		ids = append(ids, e.PkgID)
+	}
+	pinfos, err := GetPkgInfosByIDs(ids)
+	if err != nil {
+		return nil, fmt.Errorf("GetPkgInfosByIDs: %v", err)
+	}
+
+	pkgs := make(map[int64]*PkgInfo, len(pinfos))
+	for _, pinfo := range pinfos {
+		pkgs[pinfo.ID] = pinfo
+	}
+
+	// Objects match prefix as type or package name score higher.
+	scored := make(scoredPkgExports, 0, len(exports))
+	for _, e := range exports {
+		pinfo := pkgs[e.PkgID]
+		if pinfo == nil {
+			continue
+		}
+
+		score := 0
+		if len(prefix) > 0 {
+			if !strings.HasPrefix(strings.ToLower(e.Anchor), prefix+"_") &&
+				path.Base(pinfo.ImportPath) != prefix {
+				continue
+			}
+			score = 1
+		}
+		e.ImportPath = pinfo.ImportPath
+		scored = append(scored, &scoredPkgExport{e, &scoredPkgInfo{pinfo, score}})
+	}
+	sort.Sort(scored)
+
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	exports = make([]*PkgExport, len(scored))
+	for i := range scored {
+		exports[i] = scored[i].PkgExport
+	}
+	return exports, nil
+}
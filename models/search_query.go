@@ -0,0 +1,190 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-xorm/xorm"
+)
+
+var (
+	// searchAliases are legacy keywords to list special groups of packages.
+	searchAliases = map[string]string{
+		"gorepos":    "is:gorepo",
+		"gosubrepos": "is:gosubrepo",
+		"gaesdk":     "is:gae",
+	}
+
+	// searchFlags maps value of "is" filter to boolean column.
+	searchFlags = map[string]string{
+		"cmd":       "is_cmd",
+		"cgo":       "is_cgo",
+		"fork":      "is_fork",
+		"gorepo":    "is_go_repo",
+		"gosubrepo": "is_go_subrepo",
+		"gae":       "is_gae_repo",
+	}
+
+	// searchNumbers maps name of numeric filter to column.
+	searchNumbers = map[string]string{
+		"stars": "stars",
+		"views": "views",
+		"refs":  "ref_num",
+	}
+
+	// likeEscaper escapes wildcards of user input in LIKE pattern with "!",
+	// backslash is not used because MySQL treats it as escape in literals.
+	likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+)
+
+// likeEscapeClause is appended to LIKE condition whose pattern is escaped by likeEscaper.
+const likeEscapeClause = " ESCAPE '!'"
+
+// SearchOptions represents a parsed search query,
+// e.g. "web is:cmd -is:fork host:github.com stars:>100 imports:github.com/x/y".
+type SearchOptions struct {
+	Keyword string
+
+	conds []string
+	args  []interface{}
+}
+
+// HasFilters returns true if there is any filter in query.
+func (opts *SearchOptions) HasFilters() bool {
+	return len(opts.conds) > 0
+}
+
+// addFilter adds SQL condition of filter and returns false if it's not a valid filter.
+// Filter is negated when it's prefixed by "-".
+func (opts *SearchOptions) addFilter(name, value string, negative bool) bool {
+	var (
+		cond string
+		arg  interface{}
+	)
+	switch name {
+	case "is":
+		col, ok := searchFlags[value]
+		if !ok {
+			return false
+		}
+		cond, arg = col+"=?", true
+	case "host":
+		cond, arg = "import_path LIKE ?"+likeEscapeClause, likeEscaper.Replace(value)+"/%"
+	case "imports":
+		cond, arg = "id IN (SELECT pkg_id FROM pkg_import WHERE import_path=?)", value
+	default:
+		col, ok := searchNumbers[name]
+		if !ok {
+			return false
+		}
+
+		op := "="
+		for _, o := range []string{">=", "<=", ">", "<"} {
+			if strings.HasPrefix(value, o) {
+				op, value = o, value[len(o):]
+				break
+			}
+		}
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		cond, arg = col+op+"?", num
+	}
+
+	if negative {
+		cond = "NOT (" + cond + ")"
+	}
+	opts.conds = append(opts.conds, cond)
+	opts.args = append(opts.args, arg)
+	return true
+}
+
+// apply adds filter conditions to given session.
+func (opts *SearchOptions) apply(sess *xorm.Session) *xorm.Session {
+	for i := range opts.conds {
+		sess = sess.And(opts.conds[i], opts.args[i])
+	}
+	return sess
+}
+
+type queryField struct {
+	text   string
+	quoted bool
+}
+
+// splitQuery splits query into fields by white spaces, text in double quotes
+// is a single field, and an unclosed quote lasts to the end of query.
+func splitQuery(query string) []queryField {
+	fields := make([]queryField, 0, 3)
+	for {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		if len(query) == 0 {
+			return fields
+		}
+
+		if query[0] == '"' {
+			text := query[1:]
+			query = ""
+			if i := strings.IndexByte(text, '"'); i > -1 {
+				text, query = text[:i], text[i+1:]
+			}
+			if text = strings.TrimSpace(text); len(text) > 0 {
+				fields = append(fields, queryField{text, true})
+			}
+			continue
+		}
+
+		i := strings.IndexFunc(query, unicode.IsSpace)
+		if i == -1 {
+			i = len(query)
+		}
+		fields = append(fields, queryField{query[:i], false})
+		query = query[i:]
+	}
+}
+
+// ParseSearchQuery parses filters out of query, fields that are not valid
+// filters or are quoted are treated as keyword.
+func ParseSearchQuery(query string) *SearchOptions {
+	opts := new(SearchOptions)
+	keywords := make([]string, 0, 2)
+	for _, f := range splitQuery(query) {
+		field := f.text
+		if f.quoted {
+			keywords = append(keywords, field)
+			continue
+		}
+
+		if alias, ok := searchAliases[field]; ok {
+			field = alias
+		}
+
+		filter, negative := field, false
+		if strings.HasPrefix(filter, "-") {
+			filter, negative = filter[1:], true
+		}
+		i := strings.Index(filter, ":")
+		if i <= 0 || i == len(filter)-1 ||
+			!opts.addFilter(filter[:i], filter[i+1:], negative) {
+			keywords = append(keywords, field)
+		}
+	}
+	opts.Keyword = strings.Join(keywords, " ")
+	return opts
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query   string
+		keyword string
+		conds   []string
+		args    []interface{}
+	}{
+		{"web", "web", nil, nil},
+		{
+			"web is:cmd -is:fork stars:>100 refs:5 imports:github.com/x/y",
+			"web",
+			[]string{"is_cmd=?", "NOT (is_fork=?)", "stars>?", "ref_num=?",
+				"id IN (SELECT pkg_id FROM pkg_import WHERE import_path=?)"},
+			[]interface{}{true, true, int64(100), int64(5), "github.com/x/y"},
+		},
+		// Legacy keywords are aliases of filters.
+		{"gorepos", "", []string{"is_go_repo=?"}, []interface{}{true}},
+		{"gaesdk web", "web", []string{"is_gae_repo=?"}, []interface{}{true}},
+		// Invalid filters are keywords.
+		{"is:unknown stars:many foo: :bar -", "is:unknown stars:many foo: :bar -", nil, nil},
+		// Wildcards of LIKE pattern are escaped.
+		{
+			"host:my_host%!",
+			"",
+			[]string{"import_path LIKE ? ESCAPE '!'"},
+			[]interface{}{"my!_host!%!!/%"},
+		},
+		// Quoted text is a keyword even if it looks like a filter.
+		{`"is:cmd" web`, "is:cmd web", nil, nil},
+		{`  "hello   world"is:cgo "gorepos"`, "hello   world gorepos", []string{"is_cgo=?"}, []interface{}{true}},
+		{`web "unclosed is:cmd `, "web unclosed is:cmd", nil, nil},
+		{`"" " "`, "", nil, nil},
+	} {
+		opts := ParseSearchQuery(tc.query)
+		if opts.Keyword != tc.keyword {
+			t.Errorf("%q: expect keyword %q but got %q", tc.query, tc.keyword, opts.Keyword)
+		}
+		if !reflect.DeepEqual(opts.conds, tc.conds) || !reflect.DeepEqual(opts.args, tc.args) {
+			t.Errorf("%q: expect conditions %v with %v but got %v with %v",
+				tc.query, tc.conds, tc.args, opts.conds, opts.args)
+		}
+		if opts.HasFilters() != (len(tc.conds) > 0) {
+			t.Errorf("%q: expect HasFilters to be %v", tc.query, len(tc.conds) > 0)
+		}
+	}
+}
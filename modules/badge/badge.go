@@ -0,0 +1,107 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package badge renders SVG badges in styles of shields.io.
+package badge
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+)
+
+type Style string
+
+const (
+	FLAT        Style = "flat"
+	FLAT_SQUARE Style = "flat-square"
+)
+
+const (
+	COLOR_LABEL = "#555"
+	COLOR_GREEN = "#4c1"
+	COLOR_BLUE  = "#007ec6"
+	COLOR_GREY  = "#9f9f9f"
+)
+
+// ParseStyle returns corresponding style of given name,
+// it falls back to flat-square for unknown names.
+func ParseStyle(name string) Style {
+	if Style(name) == FLAT {
+		return FLAT
+	}
+	return FLAT_SQUARE
+}
+
+// textWidth estimates rendered width of text in 11px Verdana.
+func textWidth(text string) int {
+	width := 0.0
+	for _, r := range text {
+		switch {
+		case r == ' ':
+			width += 3.9
+		case r == 'i' || r == 'l' || r == 'j' || r == '.' || r == ',' || r == ':' || r == '|' || r == '!' || r == '\'':
+			width += 3.4
+		case r == 'f' || r == 'r' || r == 't' || r == '/' || r == '-' || r == '(' || r == ')':
+			width += 4.8
+		case r == 'm' || r == 'w':
+			width += 10.4
+		case r == 'M' || r == 'W':
+			width += 11.2
+		case r >= 'A' && r <= 'Z':
+			width += 7.6
+		case r > 0x7f:
+			width += 11
+		default:
+			width += 6.9
+		}
+	}
+	return int(width + 0.5)
+}
+
+// Render returns SVG of a badge with given label, message and color of message part.
+func Render(label, message, color string, style Style) []byte {
+	lw := textWidth(label) + 10
+	mw := textWidth(message) + 10
+	w := lw + mw
+
+	label = html.EscapeString(label)
+	message = html.EscapeString(message)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20">`, w)
+	if style == FLAT {
+		buf.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+		fmt.Fprintf(buf, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath><g clip-path="url(#r)">`, w)
+	} else {
+		buf.WriteString(`<g shape-rendering="crispEdges">`)
+	}
+	fmt.Fprintf(buf, `<rect width="%d" height="20" fill="%s"/><rect x="%d" width="%d" height="20" fill="%s"/>`,
+		lw, COLOR_LABEL, lw, mw, color)
+	if style == FLAT {
+		fmt.Fprintf(buf, `<rect width="%d" height="20" fill="url(#s)"/>`, w)
+	}
+	buf.WriteString(`</g><g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11">`)
+	for _, t := range []struct {
+		x    int
+		text string
+	}{{lw / 2, label}, {lw + mw/2, message}} {
+		if style == FLAT {
+			fmt.Fprintf(buf, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, t.x, t.text)
+		}
+		fmt.Fprintf(buf, `<text x="%d" y="14">%s</text>`, t.x, t.text)
+	}
+	buf.WriteString(`</g></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package badge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStyle(t *testing.T) {
+	for name, expect := range map[string]Style{
+		"flat":          FLAT,
+		"flat-square":   FLAT_SQUARE,
+		"":              FLAT_SQUARE,
+		"plastic":       FLAT_SQUARE,
+		"FLAT":          FLAT_SQUARE,
+		"for-the-badge": FLAT_SQUARE,
+	} {
+		if style := ParseStyle(name); style != expect {
+			t.Errorf("%q: expect %s but got %s", name, expect, style)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	for text, expect := range map[string]int{
+		"":         0,
+		"go":       14,
+		"doc":      21,
+		"gowalker": 53,
+		"Go Doc":   40,
+		"ill":      10,
+		"mw":       21,
+		"MW":       22,
+		"文档":       22,
+	} {
+		if w := textWidth(text); w != expect {
+			t.Errorf("%q: expect %d but got %d", text, expect, w)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, tc := range []struct {
+		style  Style
+		expect string
+	}{
+		{FLAT, `<svg xmlns="http://www.w3.org/2000/svg" width="55" height="20">` +
+			`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+			`<clipPath id="r"><rect width="55" height="20" rx="3" fill="#fff"/></clipPath><g clip-path="url(#r)">` +
+			`<rect width="24" height="20" fill="#555"/><rect x="24" width="31" height="20" fill="#007ec6"/><rect width="55" height="20" fill="url(#s)"/></g>` +
+			`<g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11">` +
+			`<text x="12" y="15" fill="#010101" fill-opacity=".3">go</text><text x="12" y="14">go</text>` +
+			`<text x="39" y="15" fill="#010101" fill-opacity=".3">doc</text><text x="39" y="14">doc</text></g></svg>`},
+		{FLAT_SQUARE, `<svg xmlns="http://www.w3.org/2000/svg" width="55" height="20">` +
+			`<g shape-rendering="crispEdges"><rect width="24" height="20" fill="#555"/><rect x="24" width="31" height="20" fill="#007ec6"/></g>` +
+			`<g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11">` +
+			`<text x="12" y="14">go</text><text x="39" y="14">doc</text></g></svg>`},
+	} {
+		if svg := string(Render("go", "doc", COLOR_BLUE, tc.style)); svg != tc.expect {
+			t.Errorf("%s: expect\n%s\nbut got\n%s", tc.style, tc.expect, svg)
+		}
+	}
+}
+
+func TestRenderEscape(t *testing.T) {
+	svg := string(Render("a<b", `"x"&'y'`, COLOR_BLUE, FLAT))
+	for _, s := range []string{">a&lt;b</text>", ">&#34;x&#34;&amp;&#39;y&#39;</text>"} {
+		if !strings.Contains(svg, s) {
+			t.Errorf("expect %s in %s", s, svg)
+		}
+	}
+	if strings.Contains(svg, "a<b") || strings.Contains(svg, `"x"`) {
+		t.Errorf("label or message is not escaped: %s", svg)
+	}
+	// Width is measured on unescaped text.
+	if !strings.Contains(svg, `width="82"`) {
+		t.Errorf("unexpected width: %s", svg)
+	}
+}
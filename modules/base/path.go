@@ -64,6 +64,19 @@ func IsValidPath(importPath string) bool {
 	return PathFlag(importPath)&packagePath != 0 || IsValidRemotePath(importPath)
 }
 
+// ParseDocPath splits import path and version in form of "<import path>@<version>".
+func ParseDocPath(docPath string) (string, string) {
+	if i := strings.LastIndex(docPath, "@"); i > -1 {
+		return docPath[:i], docPath[i+1:]
+	}
+	return docPath, ""
+}
+
+// IsValidVersion returns true if version is safe to be used as part of file path.
+func IsValidVersion(version string) bool {
+	return !strings.Contains(version, "/") && !strings.Contains(version, "..")
+}
+
 func IsDocFile(n string) bool {
 	if strings.HasSuffix(n, ".go") && n[0] != '_' && n[0] != '.' {
 		return true
@@ -0,0 +1,166 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package crawler refreshes stale packages and discovers imported packages in background.
+package crawler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Unknwon/log"
+	"github.com/robfig/cron"
+	"gopkg.in/macaron.v1"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/base"
+	"github.com/Unknwon/gowalker/modules/doc"
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+const (
+	// RETRY_INTERVAL is how long to wait before retrying a package failed to crawl,
+	// it doubles on every failure up to MAX_RETRY_INTERVAL.
+	RETRY_INTERVAL     = 24 * time.Hour
+	MAX_RETRY_INTERVAL = 30 * 24 * time.Hour
+)
+
+var (
+	render  macaron.Render
+	running int32
+
+	limiter = &hostLimiter{next: make(map[string]time.Time)}
+)
+
+// hostLimiter makes sure crawls to the same host are separated by an interval.
+type hostLimiter struct {
+	lock sync.Mutex
+	next map[string]time.Time
+}
+
+// wait blocks until it's allowed to crawl given host.
+func (l *hostLimiter) wait(host string) {
+	l.lock.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(setting.CrawlerHostInterval)
+	l.lock.Unlock()
+
+	time.Sleep(at.Sub(now))
+}
+
+// hostOf returns host of given import path.
+func hostOf(importPath string) string {
+	if base.IsGoRepoPath(importPath) {
+		return "golang.org"
+	}
+	if i := strings.Index(importPath, "/"); i > -1 {
+		return importPath[:i]
+	}
+	return importPath
+}
+
+// usesGithub returns true if given import path is crawled through GitHub API.
+func usesGithub(importPath string) bool {
+	return strings.HasPrefix(importPath, "github.com/") || base.IsGoRepoPath(importPath) ||
+		base.IsGAERepoPath(strings.TrimPrefix(importPath, "google.golang.org/"))
+}
+
+func crawl(importPath string) {
+	// Leave GitHub requests for users, the package is skipped and picked up
+	// again by a later round.
+	if usesGithub(importPath) {
+		if reset := doc.GitHubRateLimitReset(setting.CrawlerGitHubReserve); time.Now().Before(reset) {
+			log.Debug("Crawler: skip '%s', GitHub rate limit is running low until %s", importPath, reset.Format(time.RFC3339))
+			return
+		}
+	}
+
+	limiter.wait(hostOf(importPath))
+	if _, err := doc.CheckPackage(context.Background(), importPath, "", render, doc.REQUEST_TYPE_BACKGROUND); err != nil {
+		log.Warn("Crawler: fail to crawl '%s': %v", importPath, err)
+		if err = models.AddCrawlFailure(importPath, RETRY_INTERVAL, MAX_RETRY_INTERVAL); err != nil {
+			log.Error("Crawler: fail to record failure of '%s': %v", importPath, err)
+		}
+		return
+	}
+	log.Debug("Crawler: crawled '%s'", importPath)
+	if err := models.DeleteCrawlFailure(importPath); err != nil {
+		log.Error("Crawler: fail to delete failure of '%s': %v", importPath, err)
+	}
+}
+
+// run crawls a batch of stale packages and a batch of newly discovered ones.
+func run() {
+	if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+		log.Warn("Crawler: previous round is still running")
+		return
+	}
+	defer atomic.StoreInt32(&running, 0)
+
+	paths := make([]string, 0, setting.CrawlerBatchSize*2)
+	pinfos, err := models.GetStalePkgInfos(setting.CrawlerBatchSize, setting.CrawlerRefreshInterval)
+	if err != nil {
+		log.Error("Crawler: fail to get stale packages: %v", err)
+	}
+	for _, pinfo := range pinfos {
+		paths = append(paths, pinfo.ImportPath)
+	}
+
+	discovered, err := models.GetUnresolvedImportPaths(setting.CrawlerBatchSize)
+	if err != nil {
+		log.Error("Crawler: fail to get unresolved import paths: %v", err)
+	}
+	paths = append(paths, discovered...)
+
+	log.Info("Crawler: start crawling %d stale and %d discovered packages", len(pinfos), len(discovered))
+
+	tasks := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < setting.CrawlerWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for importPath := range tasks {
+				crawl(importPath)
+			}
+		}()
+	}
+	for _, p := range paths {
+		tasks <- p
+	}
+	close(tasks)
+	wg.Wait()
+}
+
+// Start starts crawler with given renderer for generating documentation
+// when it's enabled.
+func Start(r macaron.Render) {
+	if !setting.CrawlerEnabled {
+		return
+	}
+
+	render = r
+	c := cron.New()
+	if err := c.AddFunc(setting.CrawlerSchedule, run); err != nil {
+		log.FatalD(4, "Fail to add crawler job: %v", err)
+	}
+	c.Start()
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// bitbucket represents Bitbucket Cloud, API and web site are on different hosts.
+type bitbucket struct {
+	apiURL   string
+	root     string // Import path prefix.
+	user     string
+	password string
+}
+
+// newBitbucketService returns service of Bitbucket Cloud with given API base URL
+// and import path prefix, i.e. "https://api.bitbucket.org" and "bitbucket.org".
+func newBitbucketService(apiURL, root, user, password string) *service {
+	b := &bitbucket{
+		apiURL:   strings.TrimSuffix(apiURL, "/"),
+		root:     root,
+		user:     user,
+		password: password,
+	}
+	return &service{forgePattern(root), root + "/", b.getDoc}
+}
+
+// getDoc generates documentation from Bitbucket API 2.0.
+// It returns ErrNoServiceMatch if the repository is not found.
+func (b *bitbucket) getDoc(ctx context.Context, match map[string]string, etag string) (*Package, error) {
+	client := newClient(ctx)
+	header := http.Header{}
+	if len(b.user) > 0 {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(b.user+":"+b.password)))
+	}
+
+	repoPath := match["owner"] + "/" + match["repo"]
+	api := b.apiURL + "/2.0/repositories/" + repoPath
+
+	var repoInfo struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+		Parent *struct{} `json:"parent"`
+	}
+	if err := getForgeJSON(client, api, header, &repoInfo); err == errForgeNotFound {
+		return nil, ErrNoServiceMatch
+	} else if err != nil {
+		return nil, fmt.Errorf("get repository: %v", err)
+	}
+
+	// Set default branch if not presented.
+	if len(match["tag"]) == 0 {
+		match["tag"] = repoInfo.MainBranch.Name
+	}
+
+	// Check revision.
+	var commit struct {
+		Hash string `json:"hash"`
+	}
+	if err := getForgeJSON(client, api+"/commit/"+url.PathEscape(match["tag"]), header, &commit); err != nil {
+		return nil, fmt.Errorf("get revision: %v", err)
+	}
+	if commit.Hash == etag {
+		return nil, ErrPackageNotModified
+	}
+
+	// Get files of directory and its direct sub-directories, listing is paginated.
+	blobs := make([]string, 0, 10)
+	next := api + "/src/" + commit.Hash + escapePath(match["dir"]+"/") + "?max_depth=2&pagelen=100"
+	for len(next) > 0 {
+		var page struct {
+			Values []struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := getForgeJSON(client, next, header, &page); err != nil {
+			return nil, fmt.Errorf("get tree: %v", err)
+		}
+
+		for _, node := range page.Values {
+			if node.Type == "commit_file" {
+				blobs = append(blobs, node.Path)
+			}
+		}
+		next = page.Next
+	}
+
+	files, dirs := splitTree(blobs, match["dir"])
+	if len(files) == 0 && len(dirs) == 0 {
+		return nil, ErrPackageNoGoFile
+	}
+
+	projectURL := b.root + "/" + repoPath
+	srcs := make([]*Source, 0, len(files))
+	for _, f := range files {
+		srcs = append(srcs, &Source{
+			SrcName:   path.Base(f),
+			BrowseUrl: projectURL + "/src/" + commit.Hash + "/" + f,
+			RawSrcUrl: api + "/src/" + commit.Hash + escapePath("/"+f),
+		})
+	}
+
+	pdoc, err := walkForgeDoc(ctx, client, header, &models.PkgInfo{
+		ImportPath:  match["importPath"],
+		ProjectPath: projectURL,
+		ViewDirPath: projectURL + "/src/" + match["tag"] + match["dir"],
+		Etag:        commit.Hash,
+		Subdirs:     strings.Join(dirs, "|"),
+		IsFork:      repoInfo.Parent != nil,
+	}, "#lines-%d", srcs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get tags for version switcher.
+	var tags struct {
+		Values []struct {
+			Name string `json:"name"`
+		} `json:"values"`
+	}
+	if err = getForgeJSON(client, api+"/refs/tags?pagelen=100", header, &tags); err != nil {
+		// Tags are optional, documentation is still useful without them.
+		log.Warn("Fail to get tags of %s: %v", match["importPath"], err)
+	}
+	tagNames := make([]string, len(tags.Values))
+	for i := range tags.Values {
+		tagNames[i] = tags.Values[i].Name
+	}
+	pdoc.Tags = strings.Join(tagNames, "|")
+
+	return pdoc, nil
+}
@@ -15,9 +15,11 @@
 package doc
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"path"
 	"regexp"
@@ -25,6 +27,7 @@ import (
 
 	"github.com/Unknwon/com"
 	"github.com/Unknwon/log"
+	"github.com/robfig/cron"
 
 	"github.com/Unknwon/gowalker/modules/base"
 	"github.com/Unknwon/gowalker/modules/httplib"
@@ -36,30 +39,81 @@ var (
 	ErrNoServiceMatch    = errors.New("Package remote path does not match any service")
 )
 
-type crawlResult struct {
-	pdoc *Package
-	err  error
-}
-
 // service represents a source code control service.
 type service struct {
 	pattern *regexp.Regexp
 	prefix  string
-	get     func(map[string]string, string) (*Package, error)
+	get     func(context.Context, map[string]string, string) (*Package, error)
 }
 
 // services is the list of source code control services handled by gowalker.
-var services = []*service{
-	{githubPattern, "github.com/", getGithubDoc},
-	// {googlePattern, "code.google.com/", getGoogleDoc},
-	// {bitbucketPattern, "bitbucket.org/", getBitbucketDoc},
-	// {launchpadPattern, "launchpad.net/", getLaunchpadDoc},
-	// {oscPattern, "git.oschina.net/", getOSCDoc},
+var services = newServices()
+
+// newServices returns services including forges in configuration,
+// services without prefix must be the last ones.
+func newServices() []*service {
+	services := []*service{
+		{githubPattern, "github.com/", getGithubDoc},
+		// {googlePattern, "code.google.com/", getGoogleDoc},
+		// {launchpadPattern, "launchpad.net/", getLaunchpadDoc},
+		// {oscPattern, "git.oschina.net/", getOSCDoc},
+		newBitbucketService("https://api.bitbucket.org", "bitbucket.org",
+			setting.BitbucketUser, setting.BitbucketAppPassword),
+	}
+
+	// Token of a self-hosted instance must never be sent to gitlab.com,
+	// which is only authenticated when it's configured explicitly.
+	gitlabs := setting.GitLabInstances
+	if !hasForgeInstance(gitlabs, "gitlab.com") {
+		gitlabs = append([]setting.ForgeInstance{{URL: "https://gitlab.com"}}, gitlabs...)
+	}
+	for _, inst := range gitlabs {
+		s, err := newGitlabService(inst.URL, inst.Token)
+		if err != nil {
+			log.Fatal("Invalid GitLab URL '%s': %v", inst.URL, err)
+		}
+		services = append(services, s)
+	}
+	for _, inst := range setting.GiteaInstances {
+		s, err := newGiteaService(inst.URL, inst.Token)
+		if err != nil {
+			log.Fatal("Invalid Gitea URL '%s': %v", inst.URL, err)
+		}
+		services = append(services, s)
+	}
+
+	return append(services,
+		&service{vcsPattern, "", getVCSDoc},
+		&service{goproxyPattern, "", getGoProxyDoc})
+}
+
+// hasForgeInstance returns true if any of given instances is hosted at given root.
+func hasForgeInstance(instances []setting.ForgeInstance, root string) bool {
+	for _, inst := range instances {
+		if r, err := forgeRoot(inst.URL); err == nil && r == root {
+			return true
+		}
+	}
+	return false
 }
 
-// getStatic gets a document from a statically known service.
+// Init sets up services and GitHub credentials in configuration, and starts
+// eviction of VCS cache. It must be called after settings are loaded.
+func Init() {
+	services = newServices()
+	githubTokens = newTokenPool()
+
+	c := cron.New()
+	if err := c.AddFunc(EVICT_SCHEDULE, evictRepos); err != nil {
+		log.FatalD(4, "Fail to add eviction job: %v", err)
+	}
+	c.Start()
+}
+
+// getStatic gets a document of given tag from a statically known service,
+// empty tag means the default branch.
 // It returns ErrNoServiceMatch if the import path is not recognized.
-func getStatic(importPath, etag string) (pdoc *Package, err error) {
+func getStatic(ctx context.Context, importPath, tag, etag string) (pdoc *Package, err error) {
 	for _, s := range services {
 		if s.get == nil || !strings.HasPrefix(importPath, s.prefix) {
 			continue
@@ -73,12 +127,15 @@ func getStatic(importPath, etag string) (pdoc *Package, err error) {
 			continue
 		}
 		match := map[string]string{"importPath": importPath}
+		if len(tag) > 0 {
+			match["tag"] = tag
+		}
 		for i, n := range s.pattern.SubexpNames() {
 			if n != "" {
 				match[n] = m[i]
 			}
 		}
-		return s.get(match, etag)
+		return s.get(ctx, match, etag)
 	}
 	return nil, ErrNoServiceMatch
 }
@@ -159,7 +216,7 @@ metaScan:
 	return match, nil
 }
 
-func fetchMeta(importPath string) (map[string]string, error) {
+func fetchMeta(ctx context.Context, importPath string) (map[string]string, error) {
 	uri := importPath
 	if !strings.Contains(uri, "/") {
 		// Add slash for root of domain.
@@ -167,14 +224,15 @@ func fetchMeta(importPath string) (map[string]string, error) {
 	}
 	uri = uri + "?go-get=1"
 
+	client := newClient(ctx)
 	scheme := "https"
-	resp, err := Client.Get(scheme + "://" + uri)
+	resp, err := client.Get(scheme + "://" + uri)
 	if err != nil || resp.StatusCode != 200 {
 		if err == nil {
 			resp.Body.Close()
 		}
 		scheme = "http"
-		resp, err = Client.Get(scheme + "://" + uri)
+		resp, err = client.Get(scheme + "://" + uri)
 		if err != nil {
 			return nil, err
 		}
@@ -183,14 +241,14 @@ func fetchMeta(importPath string) (map[string]string, error) {
 	return parseMeta(scheme, importPath, resp.Body)
 }
 
-func getDynamic(importPath, etag string) (pdoc *Package, err error) {
-	match, err := fetchMeta(importPath)
+func getDynamic(ctx context.Context, importPath, tag, etag string) (pdoc *Package, err error) {
+	match, err := fetchMeta(ctx, importPath)
 	if err != nil {
 		return nil, err
 	}
 
 	if match["projectRoot"] != importPath {
-		rootMatch, err := fetchMeta(match["projectRoot"])
+		rootMatch, err := fetchMeta(ctx, match["projectRoot"])
 		if err != nil {
 			return nil, err
 		}
@@ -206,9 +264,12 @@ func getDynamic(importPath, etag string) (pdoc *Package, err error) {
 		match["repo"] = "github.com/golang"
 	}
 
-	pdoc, err = getStatic(com.Expand("{repo}{dir}", match), etag)
+	pdoc, err = getStatic(ctx, com.Expand("{repo}{dir}", match), tag, etag)
 	if err == ErrNoServiceMatch {
-		pdoc, err = getVCSDoc(match, etag)
+		if len(tag) > 0 {
+			match["tag"] = tag
+		}
+		pdoc, err = getVCSDoc(ctx, match, etag)
 	} else if pdoc != nil {
 		pdoc.ImportPath = importPath
 		pdoc.IsGoSubrepo = isGoSubrepo
@@ -220,33 +281,59 @@ func getDynamic(importPath, etag string) (pdoc *Package, err error) {
 	return pdoc, err
 }
 
-func crawlDoc(importPath, etag string) (pdoc *Package, err error) {
-	switch {
-	case base.IsGoRepoPath(importPath):
-		pdoc, err = getGolangDoc(importPath, etag)
-	case base.IsGAERepoPath(strings.TrimPrefix(importPath, "google.golang.org/")):
-		subPath := strings.TrimPrefix(importPath, "google.golang.org/")
-		pdoc, err = getStatic("github.com/golang/"+subPath, etag)
-		if pdoc != nil {
-			pdoc.ImportPath = importPath
-			pdoc.IsGaeRepo = true
-		}
-	case base.IsValidRemotePath(importPath):
-		pdoc, err = getStatic(importPath, etag)
-		if err == ErrNoServiceMatch {
-			pdoc, err = getDynamic(importPath, etag)
+// crawlDoc fetches and generates documentation of given tag,
+// empty tag means the default branch. All remote requests and commands
+// are canceled when given context is done.
+func crawlDoc(ctx context.Context, importPath, tag, etag string) (pdoc *Package, err error) {
+	setJobState(ctx, JOB_FETCHING)
+
+	// Local roots take precedence over any remote service.
+	isLocal := false
+	if setting.PrivateMode {
+		pdoc, err = getLocalDoc(importPath, tag, etag)
+		isLocal = err != ErrNoLocalMatch
+	}
+
+	if !setting.PrivateMode || (err == ErrNoLocalMatch && !setting.OfflineMode) {
+		switch {
+		case base.IsGoRepoPath(importPath):
+			pdoc, err = getGolangDoc(ctx, importPath, tag, etag)
+		case base.IsGAERepoPath(strings.TrimPrefix(importPath, "google.golang.org/")):
+			subPath := strings.TrimPrefix(importPath, "google.golang.org/")
+			pdoc, err = getStatic(ctx, "github.com/golang/"+subPath, tag, etag)
+			if pdoc != nil {
+				pdoc.ImportPath = importPath
+				pdoc.IsGaeRepo = true
+			}
+		case base.IsValidRemotePath(importPath):
+			pdoc, err = getStatic(ctx, importPath, tag, etag)
+			if err == ErrNoServiceMatch {
+				pdoc, err = getDynamic(ctx, importPath, tag, etag)
+			}
+		default:
+			err = ErrInvalidRemotePath
 		}
-	default:
-		err = ErrInvalidRemotePath
 	}
 
 	if err != nil {
 		return nil, err
 	}
+	pdoc.Version = tag
 
 	// Render README.
+	if len(pdoc.Readme) > 0 {
+		setJobState(ctx, JOB_RENDERING)
+	}
 	for name, content := range pdoc.Readme {
-		p, err := httplib.Post("https://api.github.com/markdown/raw?"+setting.GitHubCredentials).
+		// Remote rendering is not available in offline mode, and source of
+		// local packages must not be sent to GitHub.
+		if setting.OfflineMode || isLocal {
+			pdoc.Readme[name] = []byte("<pre>" + template.HTMLEscapeString(string(content)) + "</pre>")
+			continue
+		}
+
+		p, err := httplib.Post("https://api.github.com/markdown/raw").
+			SetTransport(&githubTransport{ctx}).
 			Header("Content-Type", "text/plain").Body(content).Bytes()
 		if err != nil {
 			return nil, fmt.Errorf("error rendering README: %v", err)
@@ -0,0 +1,227 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+
+	"gopkg.in/macaron.v1"
+)
+
+// DiffItem represents an exported object that is different between two versions.
+type DiffItem struct {
+	Kind    string `json:"kind"` // func, method, type, const or var.
+	Name    string `json:"name"` // Method name is in form of "Type.Method".
+	OldDecl string `json:"old_decl,omitempty"`
+	NewDecl string `json:"new_decl,omitempty"`
+}
+
+// APIDiff represents differences of exported API between two versions of a package.
+type APIDiff struct {
+	ImportPath string      `json:"import_path"`
+	Old        string      `json:"old"`
+	New        string      `json:"new"`
+	Added      []*DiffItem `json:"added"`
+	Removed    []*DiffItem `json:"removed"`
+	Changed    []*DiffItem `json:"changed"`
+}
+
+// IsEmpty returns true if there is no difference.
+func (d *APIDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// splitValueDecl returns declaration of every exported name in a possibly
+// grouped const or var declaration. Implicitly repeated type and values in
+// a const group are written out, so adding one name to a group does not
+// change declarations of other names and a change of repeated expressions
+// changes declarations of all names repeating them. Value of iota is not
+// compared because unexported names are already removed from declaration.
+// The whole declaration is used for every name if it cannot be parsed.
+func splitValueDecl(names, decl string) map[string]string {
+	decls := make(map[string]string)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package p\n"+decl, 0)
+	if err != nil || len(f.Decls) != 1 {
+		for _, name := range strings.Split(names, ", ") {
+			decls[name] = decl
+		}
+		return decls
+	}
+
+	printExprs := func(exprs []ast.Expr) string {
+		strs := make([]string, len(exprs))
+		for i, e := range exprs {
+			var buf bytes.Buffer
+			printer.Fprint(&buf, fset, e)
+			strs[i] = buf.String()
+		}
+		return strings.Join(strs, ", ")
+	}
+
+	gd := f.Decls[0].(*ast.GenDecl)
+	var last *ast.ValueSpec
+	for _, spec := range gd.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		typ, values := vs.Type, vs.Values
+		if gd.Tok == token.CONST && typ == nil && len(values) == 0 && last != nil {
+			typ, values = last.Type, last.Values
+		} else {
+			last = vs
+		}
+
+		for j, name := range vs.Names {
+			if !ast.IsExported(name.Name) {
+				continue
+			}
+
+			lhs, rhs := []ast.Expr{name}, values
+			if len(values) == len(vs.Names) {
+				rhs = values[j : j+1]
+			} else if len(values) > 0 {
+				// Values of multiple names come from a single call.
+				lhs = make([]ast.Expr, len(vs.Names))
+				for k := range vs.Names {
+					lhs[k] = vs.Names[k]
+				}
+			}
+
+			d := gd.Tok.String() + " " + printExprs(lhs)
+			if typ != nil {
+				d += " " + printExprs([]ast.Expr{typ})
+			}
+			if len(rhs) > 0 {
+				d += " = " + printExprs(rhs)
+			}
+			decls[name.Name] = d
+		}
+	}
+	return decls
+}
+
+// apiDecls returns declarations of all exported objects keyed by kind and name.
+func apiDecls(pdoc *Package) map[string]*DiffItem {
+	decls := make(map[string]*DiffItem)
+	add := func(kind, name, decl string) {
+		decls[kind+" "+name] = &DiffItem{
+			Kind:    kind,
+			Name:    name,
+			NewDecl: decl,
+		}
+	}
+	// Every name of grouped values is compared on its own.
+	addValues := func(kind string, vals []*Value) {
+		for _, v := range vals {
+			for name, decl := range splitValueDecl(v.Name, v.Decl) {
+				add(kind, name, decl)
+			}
+		}
+	}
+
+	addValues("const", pdoc.Consts)
+	addValues("var", pdoc.Vars)
+	for _, f := range pdoc.Funcs {
+		add("func", f.Name, f.Decl)
+	}
+	for _, t := range pdoc.Types {
+		add("type", t.Name, t.Decl)
+		addValues("const", t.Consts)
+		addValues("var", t.Vars)
+		for _, f := range t.Funcs {
+			add("func", f.Name, f.Decl)
+		}
+		for _, m := range t.Methods {
+			add("method", t.Name+"."+m.Name, m.Decl)
+		}
+	}
+	return decls
+}
+
+type diffItems []*DiffItem
+
+func (s diffItems) Len() int { return len(s) }
+func (s diffItems) Less(i, j int) bool {
+	if s[i].Kind != s[j].Kind {
+		return s[i].Kind < s[j].Kind
+	}
+	return s[i].Name < s[j].Name
+}
+func (s diffItems) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// DiffPackage compares exported API of two versions of a package.
+func DiffPackage(oldDoc, newDoc *Package) *APIDiff {
+	diff := &APIDiff{
+		ImportPath: newDoc.ImportPath,
+		Old:        oldDoc.Version,
+		New:        newDoc.Version,
+		Added:      []*DiffItem{},
+		Removed:    []*DiffItem{},
+		Changed:    []*DiffItem{},
+	}
+
+	oldDecls := apiDecls(oldDoc)
+	newDecls := apiDecls(newDoc)
+	for key, item := range newDecls {
+		old, ok := oldDecls[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, item)
+		case old.NewDecl != item.NewDecl:
+			item.OldDecl = old.NewDecl
+			diff.Changed = append(diff.Changed, item)
+		}
+	}
+	for key, item := range oldDecls {
+		if _, ok := newDecls[key]; !ok {
+			item.OldDecl, item.NewDecl = item.NewDecl, ""
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+
+	sort.Sort(diffItems(diff.Added))
+	sort.Sort(diffItems(diff.Removed))
+	sort.Sort(diffItems(diff.Changed))
+	return diff
+}
+
+// GetAPIDiff compares exported API of two versions of given import path,
+// empty version means the default branch. Versions are generated first if
+// they haven't been, and it returns ErrGenerating if that takes too long.
+func GetAPIDiff(ctx context.Context, render macaron.Render, importPath, oldVer, newVer string) (*APIDiff, error) {
+	oldDoc, err := GetPackage(ctx, importPath, oldVer, render)
+	if err != nil {
+		return nil, err
+	}
+	newDoc, err := GetPackage(ctx, importPath, newVer, render)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffPackage(oldDoc, newDoc)
+	diff.ImportPath = importPath
+	diff.Old = oldVer
+	diff.New = newVer
+	return diff, nil
+}
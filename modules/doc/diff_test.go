@@ -0,0 +1,88 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"testing"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+func TestSplitValueDecl(t *testing.T) {
+	decls := splitValueDecl("A, B, c, D, E, F", `const (
+	A Kind = iota
+	B
+	c
+	D, E = 1, "e"
+	F
+)`)
+	for name, expect := range map[string]string{
+		"A": "const A Kind = iota",
+		"B": "const B Kind = iota",
+		"D": "const D = 1",
+		"E": `const E = "e"`,
+		"F": `const F = 1, "e"`,
+	} {
+		if decls[name] != expect {
+			t.Errorf("%s: expect %q but got %q", name, expect, decls[name])
+		}
+	}
+	if _, ok := decls["c"]; ok {
+		t.Error("unexported name is included")
+	}
+
+	decls = splitValueDecl("A, B", "var A, B = f()")
+	if expect := "var A, B = f()"; decls["A"] != expect || decls["B"] != expect {
+		t.Errorf("expect %q but got %q and %q", expect, decls["A"], decls["B"])
+	}
+}
+
+// newConstPackage returns a package with given const declaration.
+func newConstPackage(version, names, decl string) *Package {
+	return &Package{
+		PkgInfo: &models.PkgInfo{Version: version},
+		PkgDecl: &PkgDecl{File: File{Consts: []*Value{{Name: names, Decl: decl}}}},
+	}
+}
+
+func TestDiffPackageGroupedValues(t *testing.T) {
+	oldDoc := newConstPackage("v1", "A, B", "const (\n\tA Kind = iota\n\tB\n)")
+	newDoc := newConstPackage("v2", "A, B, C", "const (\n\tA Kind = iota\n\tB\n\tC\n)")
+
+	diff := DiffPackage(oldDoc, newDoc)
+	if len(diff.Added) != 1 || diff.Added[0].Name != "C" || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Fatalf("expect only C to be added but got: %+v", diff)
+	}
+
+	// Names repeating a changed expression are changed as well.
+	newDoc = newConstPackage("v2", "A, B", "const (\n\tA Kind = 1 << iota\n\tB\n)")
+	diff = DiffPackage(oldDoc, newDoc)
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 || len(diff.Changed) != 2 ||
+		diff.Changed[1].NewDecl != "const B Kind = 1 << iota" {
+		t.Fatalf("expect A and B to be changed but got: %+v", diff)
+	}
+}
+
+func TestDiffPackageFilteredValues(t *testing.T) {
+	// Sources are "A Kind = iota; x; B" and "A Kind = iota; X; B", unexported x
+	// is removed by go/doc so B is printed at different positions.
+	oldDoc := newConstPackage("v1", "A, B", "const (\n\tA Kind = iota\n\tB\n)")
+	newDoc := newConstPackage("v2", "A, X, B", "const (\n\tA Kind = iota\n\tX\n\tB\n)")
+
+	diff := DiffPackage(oldDoc, newDoc)
+	if len(diff.Added) != 1 || diff.Added[0].Name != "X" || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Fatalf("expect only X to be added but got: %+v", diff)
+	}
+}
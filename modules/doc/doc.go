@@ -16,6 +16,8 @@ package doc
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
@@ -24,9 +26,9 @@ import (
 	"html/template"
 	"io"
 	"io/ioutil"
-	"os"
 	"path"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -37,10 +39,12 @@ import (
 
 	"github.com/Unknwon/gowalker/models"
 	"github.com/Unknwon/gowalker/modules/setting"
+	"github.com/Unknwon/gowalker/modules/storage"
 )
 
 var (
 	ErrFetchTimeout = errors.New("Fetch package timeout")
+	ErrGenerating   = errors.New("Package documentation is being generated")
 )
 
 // A link describes the (HTML) link information for an identifier.
@@ -330,107 +334,105 @@ func getExamples(pdoc *Package, typeName, name string) (exams []*Example) {
 	return exams
 }
 
-// SaveDocPage saves doc. content to JS file(s),
-// it returns max index of JS file(s);
-// it returns -1 when error occurs.
-func SaveDocPage(docPath string, data []byte) int {
-	data = com.Html2JS(data)
-	docPath = setting.DocsJsPath + docPath
-
-	buf := new(bytes.Buffer)
-	count := 0
-	d := string(data)
-	l := len(d)
-	if l < 80000 {
-		buf.WriteString("document.write(\"")
-		buf.Write(data)
-		buf.WriteString("\")")
-
-		os.MkdirAll(path.Dir(docPath+".js"), os.ModePerm)
-		if err := ioutil.WriteFile(docPath+".js", buf.Bytes(), 0655); err != nil {
-			log.ErrorD(4, "SaveDocPage( %s ): %v", docPath, err)
-			return -1
-		}
-	} else {
-		// Too large, need to sperate.
-		start := 0
-		end := start + 40000
-		for {
-			if end >= l {
-				end = l
-			} else {
-				// Need to break in space.
-				for {
-					if d[end-3:end] == "/b>" {
-						break
-					}
-					end += 1
-
-					if end >= l {
-						break
-					}
-				}
-			}
-
-			buf.WriteString("document.write(\"")
-			buf.WriteString(d[start:end])
-			buf.WriteString("\")\n")
+// saveHTML saves HTML fragment to storage in gzip format,
+// it returns key of the blob.
+func saveHTML(data []byte) (string, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		return "", err
+	} else if err = gw.Close(); err != nil {
+		return "", err
+	}
 
-			p := docPath
-			if count != 0 {
-				p += fmt.Sprintf("-%d", count)
-			}
+	key := storage.Key(data)
+	return key, storage.Put(key, buf.Bytes())
+}
 
-			os.MkdirAll(path.Dir(p+".js"), os.ModePerm)
-			if err := ioutil.WriteFile(p+".js", buf.Bytes(), 0655); err != nil {
-				log.ErrorD(4, "SaveDocPage( %s ): %v", p, err)
-				return -1
-			}
+// readHTML reads HTML fragment saved by saveHTML.
+func readHTML(key string) (string, error) {
+	blob, err := storage.Get(key)
+	if err != nil {
+		return "", err
+	}
 
-			if end >= l {
-				break
-			}
+	gr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return "", err
+	}
+	defer gr.Close()
 
-			buf.Reset()
-			start = end
-			end += 204800
-			count++
-		}
+	data, err := ioutil.ReadAll(gr)
+	if err != nil {
+		return "", err
 	}
+	return string(data), nil
+}
+
+// SaveDocPage saves rendered documentation, it returns key of the blob.
+func SaveDocPage(data []byte) (string, error) {
+	return saveHTML(data)
+}
 
-	return count
+// ReadDocPage returns rendered documentation of given package,
+// it returns storage.ErrNotExist if the blob is missing.
+func ReadDocPage(pinfo *models.PkgInfo) (string, error) {
+	return readHTML(pinfo.DocKey)
 }
 
-// SavePkgDoc saves readered readme.md file data.
-func SavePkgDoc(docPath string, readmes map[string][]byte) {
+// SavePkgDoc saves readered readme.md file data, it returns keys of blobs
+// in form of "<lang>:<key>|<lang>:<key>". Nothing more is saved once given
+// context is done.
+func SavePkgDoc(ctx context.Context, readmes map[string][]byte) (string, error) {
+	keys := make([]string, 0, len(readmes))
 	for lang, data := range readmes {
 		if len(data) == 0 {
 			continue
+		} else if err := ctx.Err(); err != nil {
+			return "", err
 		}
 
 		if data[0] == '\n' {
 			data = data[1:]
 		}
 
-		data = com.Html2JS(data)
-		localeDocPath := setting.DocsJsPath + docPath + "_RM_" + lang
-		os.MkdirAll(path.Dir(localeDocPath), os.ModePerm)
+		key, err := saveHTML(data)
+		if err != nil {
+			log.ErrorD(4, "SavePkgDoc( %s ): %v", lang, err)
+			continue
+		}
+		keys = append(keys, lang+":"+key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "|"), nil
+}
+
+// ReadPkgDoc returns rendered readme.md file data of given language,
+// it falls back to English and returns empty string if there is none.
+func ReadPkgDoc(pinfo *models.PkgInfo, lang string) string {
+	for _, lang := range []string{lang, "en"} {
+		key := pinfo.ReadmeKey(lang)
+		if len(key) == 0 {
+			continue
+		}
 
-		buf := new(bytes.Buffer)
-		buf.WriteString("document.write(\"")
-		buf.Write(data)
-		buf.WriteString("\")")
-		if err := ioutil.WriteFile(localeDocPath+".js", buf.Bytes(), 0655); err != nil {
-			log.ErrorD(4, "SavePkgDoc( %s ): %v", localeDocPath, err)
+		data, err := readHTML(key)
+		if err != nil {
+			log.Error("ReadPkgDoc( %s ): %v", pinfo.DocPath(), err)
+			continue
 		}
+		return data
 	}
+	return ""
 }
 
 type exportSearchObject struct {
 	Title string `json:"title"`
 }
 
-func renderDoc(render macaron.Render, pdoc *Package, docPath string) error {
+// renderDoc renders and saves documentation and README blobs of package,
+// it stops before saving the next blob once given context is done.
+func renderDoc(ctx context.Context, render macaron.Render, pdoc *Package) error {
 	data := make(map[string]interface{})
 	data["PkgFullIntro"] = pdoc.Doc
 	data["IsGoRepo"] = pdoc.IsGoRepo
@@ -661,44 +663,188 @@ func renderDoc(render macaron.Render, pdoc *Package, docPath string) error {
 		return fmt.Errorf("error rendering HTML: %v", err)
 	}
 
-	pdoc.JsNum = SaveDocPage(docPath, result)
-	if pdoc.JsNum == -1 {
-		return errors.New("Save JS file wasn't successful")
+	if pdoc.DocKey, err = SaveDocPage(result); err != nil {
+		return fmt.Errorf("save doc page: %v", err)
+	} else if err = ctx.Err(); err != nil {
+		return err
+	}
+	if pdoc.ReadmeKeys, err = SavePkgDoc(ctx, pdoc.Readme); err != nil {
+		return err
 	}
-	SavePkgDoc(pdoc.ImportPath, pdoc.Readme)
 
 	data["UtcTime"] = time.Unix(pdoc.Created, 0).UTC()
 	return nil
 }
 
+// SNAPSHOT_VER is modified when previously saved snapshots can't be decoded
+// to current Package correctly.
+const SNAPSHOT_VER = 1
+
+var errSnapshotOutdated = errors.New("Snapshot version is outdated")
+
+// decodeSnapshot decodes package from gob snapshot.
+func decodeSnapshot(blob []byte) (*Package, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("read gzip: %v", err)
+	}
+	defer gr.Close()
+
+	dec := gob.NewDecoder(gr)
+	var ver int
+	if err = dec.Decode(&ver); err != nil {
+		return nil, fmt.Errorf("decode version: %v", err)
+	} else if ver != SNAPSHOT_VER {
+		return nil, errSnapshotOutdated
+	}
+
+	pdoc := new(Package)
+	if err = dec.Decode(pdoc); err != nil {
+		return nil, fmt.Errorf("decode gob: %v", err)
+	}
+	return pdoc, nil
+}
+
+// loadSnapshot returns package from snapshot of given package info. Snapshot
+// that is missing, outdated or corrupted is cleared from the package info,
+// so the next crawl fetches everything again instead of being told the
+// package is not modified.
+func loadSnapshot(pinfo *models.PkgInfo) (*Package, error) {
+	blob, err := storage.Get(pinfo.SnapshotKey)
+	if err == nil {
+		var pdoc *Package
+		if pdoc, err = decodeSnapshot(blob); err == nil {
+			return pdoc, nil
+		}
+	} else if err != storage.ErrNotExist {
+		return nil, fmt.Errorf("get snapshot: %v", err)
+	}
+
+	if rerr := models.ResetPkgSnapshotKey(pinfo.ID); rerr != nil {
+		return nil, fmt.Errorf("reset snapshot key: %v", rerr)
+	}
+	pinfo.SnapshotKey = ""
+	return nil, err
+}
+
+// encodeSnapshot encodes package to compressed gob snapshot with version,
+// it returns the blob and key of the snapshot.
+func encodeSnapshot(pdoc *Package) ([]byte, string, error) {
+	var data bytes.Buffer
+	enc := gob.NewEncoder(&data)
+	if err := enc.Encode(SNAPSHOT_VER); err != nil {
+		return nil, "", fmt.Errorf("encode version: %v", err)
+	} else if err = enc.Encode(pdoc); err != nil {
+		return nil, "", fmt.Errorf("encode gob: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data.Bytes()); err != nil {
+		return nil, "", err
+	} else if err = gw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), storage.Key(data.Bytes()), nil
+}
+
+// RerenderPackage renders documentation from snapshot of given package without
+// fetching anything, and saves new keys of rendered blobs.
+func RerenderPackage(render macaron.Render, pinfo *models.PkgInfo) error {
+	pdoc, err := loadSnapshot(pinfo)
+	if err != nil {
+		return err
+	}
+
+	if err = renderDoc(context.Background(), render, pdoc); err != nil {
+		return fmt.Errorf("render doc: %v", err)
+	}
+	pinfo.DocKey, pinfo.ReadmeKeys = pdoc.DocKey, pdoc.ReadmeKeys
+	return models.UpdatePkgDocKeys(pinfo)
+}
+
+// crawlWithTimeout fetches package from VCS and cancels it when given context is done,
+// it returns ErrFetchTimeout if it takes longer than setting.FetchTimeout.
+func crawlWithTimeout(ctx context.Context, importPath, version, etag string) (*Package, error) {
+	ctx, cancel := context.WithTimeout(ctx, setting.FetchTimeout)
+	defer cancel()
+
+	pdoc, err := crawlDoc(ctx, importPath, version, etag)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, ErrFetchTimeout
+	} else if err == nil && ctx.Err() != nil {
+		// Result could be incomplete if cancellation is not noticed by every step.
+		return nil, ctx.Err()
+	}
+	return pdoc, err
+}
+
+// GetPackage returns full documentation of given version without rendering
+// from snapshot, the package is generated and saved first if it has no snapshot,
+// so concurrent requests share the same generation.
+// It returns ErrGenerating if the generation takes too long.
+func GetPackage(ctx context.Context, importPath, version string, render macaron.Render) (*Package, error) {
+	pinfo, err := models.GetVersionPkgInfo(importPath, version)
+	if err != nil || len(pinfo.SnapshotKey) == 0 {
+		if pinfo, err = CheckPackage(ctx, importPath, version, render, REQUEST_TYPE_REFRESH); err != nil {
+			return nil, err
+		}
+	}
+	pdoc, err := loadSnapshot(pinfo)
+	if err == nil || len(pinfo.SnapshotKey) > 0 {
+		return pdoc, err
+	}
+
+	// Snapshot is unusable and has been cleared, generate it again.
+	if pinfo, err = CheckPackage(ctx, importPath, version, render, REQUEST_TYPE_REFRESH); err != nil {
+		return nil, err
+	}
+	return loadSnapshot(pinfo)
+}
+
+// GENERATING_WAIT is how long a request waits for generation before it's told to
+// check progress of the job later.
+const GENERATING_WAIT = 5 * time.Second
+
+// generations coalesces concurrent generations of the same version of package.
+var generations = &flightGroup{calls: make(map[string]*flightCall)}
+
 type requestType int
 
 const (
 	REQUEST_TYPE_HUMAN requestType = iota
 	REQUEST_TYPE_REFRESH
+	REQUEST_TYPE_BACKGROUND // Refresh that waits until generation is finished.
 )
 
-// CheckGoPackage checks package by import path.
-func CheckPackage(importPath string, render macaron.Render, rt requestType) (*models.PkgInfo, error) {
-	// Trim prefix of standard library.
-	importPath = strings.TrimPrefix(importPath, "github.com/golang/go/tree/master/src")
+// trimImportPath trims prefix of standard library.
+func trimImportPath(importPath string) string {
+	return strings.TrimPrefix(importPath, "github.com/golang/go/tree/master/src")
+}
 
-	pinfo, err := models.GetPkgInfo(importPath)
-	if rt != REQUEST_TYPE_REFRESH {
-		if err == nil {
-			fpath := setting.DocsGobPath + importPath + ".gob"
-			if !setting.ProdMode && com.IsFile(fpath) {
-				pdoc := new(Package)
-				fr, err := os.Open(fpath)
-				if err != nil {
-					return nil, fmt.Errorf("read gob: %v", err)
-				} else if err = gob.NewDecoder(fr).Decode(pdoc); err != nil {
-					fr.Close()
-					return nil, fmt.Errorf("decode gob: %v", err)
-				}
-				fr.Close()
+// DocPath returns doc path of given import path and version in form of
+// "<import path>@<version>", which is the key of generations and jobs.
+func DocPath(importPath, version string) string {
+	importPath = trimImportPath(importPath)
+	if len(version) == 0 {
+		return importPath
+	}
+	return importPath + "@" + version
+}
+
+// CheckPackage checks package by import path and version, empty version means
+// the default branch. Generation is canceled if all requests waiting for it are done,
+// unless one of them has been told to check progress of the job later.
+func CheckPackage(ctx context.Context, importPath, version string, render macaron.Render, rt requestType) (*models.PkgInfo, error) {
+	importPath = trimImportPath(importPath)
+	docPath := DocPath(importPath, version)
 
-				if err = renderDoc(render, pdoc, importPath); err != nil {
+	pinfo, err := models.GetVersionPkgInfo(importPath, version)
+	if rt == REQUEST_TYPE_HUMAN {
+		if err == nil {
+			// Always render from snapshot for development of templates.
+			if !setting.ProdMode && len(pinfo.SnapshotKey) > 0 {
+				if err = RerenderPackage(render, pinfo); err != nil {
 					return nil, fmt.Errorf("render cached doc: %v", err)
 				}
 			}
@@ -716,34 +862,52 @@ func CheckPackage(importPath string, render macaron.Render, rt requestType) (*mo
 		return nil, err
 	}
 
+	// Package without snapshot is crawled again even if it's not modified.
 	var etag string
-	if err != models.ErrPackageVersionTooOld && pinfo != nil {
+	if err != models.ErrPackageVersionTooOld && pinfo != nil && len(pinfo.SnapshotKey) > 0 {
 		etag = pinfo.Etag
 	}
 
-	// Fetch package from VCS.
-	c := make(chan crawlResult, 1)
-	go func() {
-		pdoc, err := crawlDoc(importPath, etag)
-		c <- crawlResult{pdoc, err}
-	}()
+	call, _ := generations.do(docPath, func(ctx context.Context) (*models.PkgInfo, error) {
+		job := jobs.add(importPath, version)
+		pinfo, err := generateDoc(withJob(ctx, job), importPath, version, etag, pinfo, render)
+		job.finish(err)
+		return pinfo, err
+	})
+
+	// Requests do not wait too long for slow generation, the job keeps going
+	// for them to check progress and come back later.
+	var generating <-chan time.Time
+	if rt != REQUEST_TYPE_BACKGROUND {
+		generating = time.After(GENERATING_WAIT)
+	}
 
-	var pdoc *Package
-	err = nil // Reset.
 	select {
-	case cr := <-c:
-		if cr.err == nil {
-			pdoc = cr.pdoc
-		} else {
-			err = cr.err
-		}
-	case <-time.After(setting.FetchTimeout):
-		err = ErrFetchTimeout
+	case <-call.done:
+		generations.leave(call)
+		return call.pinfo, call.err
+	case <-generating:
+		// The request hands its reference over to the job, so generation is no
+		// longer canceled for it but still bounded by fetch timeout. Reference
+		// is released once generation finishes.
+		go func() {
+			<-call.done
+			generations.leave(call)
+		}()
+		return nil, ErrGenerating
+	case <-ctx.Done():
+		generations.leave(call)
+		return nil, ctx.Err()
 	}
+}
 
+// generateDoc crawls, renders and saves documentation of given version of package,
+// pinfo is nil if package hasn't been generated before.
+func generateDoc(ctx context.Context, importPath, version, etag string, pinfo *models.PkgInfo, render macaron.Render) (*models.PkgInfo, error) {
+	pdoc, err := crawlWithTimeout(ctx, importPath, version, etag)
 	if err != nil {
 		if err == ErrPackageNotModified {
-			log.Debug("Package has not been modified: %s", pinfo.ImportPath)
+			log.Debug("Package has not been modified: %s", pinfo.DocPath())
 			// Update time so cannot refresh too often.
 			pinfo.Created = time.Now().UTC().Unix()
 			return pinfo, models.SavePkgInfo(pinfo, false)
@@ -753,35 +917,65 @@ func CheckPackage(importPath string, render macaron.Render, rt requestType) (*mo
 		return nil, fmt.Errorf("check package: %v", err)
 	}
 
-	if !setting.ProdMode {
-		fpath := setting.DocsGobPath + importPath + ".gob"
-		os.MkdirAll(path.Dir(fpath), os.ModePerm)
-		fw, err := os.Create(fpath)
-		if err != nil {
-			return nil, fmt.Errorf("create gob: %v", err)
-		}
-		defer fw.Close()
-		if err = gob.NewEncoder(fw).Encode(pdoc); err != nil {
-			return nil, fmt.Errorf("encode gob: %v", err)
-		}
+	// Nobody is waiting for the result anymore, leave everything as it was.
+	if err = ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	log.Info("Walked package: %s, Goroutine #%d", pdoc.ImportPath, runtime.NumGoroutine())
+	setJobState(ctx, JOB_RENDERING)
+	// Snapshot must be encoded before rendering because rendering modifies package,
+	// but it's only saved once documentation is rendered and saved.
+	snapshot, snapshotKey, err := encodeSnapshot(pdoc)
+	if err != nil {
+		return nil, fmt.Errorf("encode snapshot: %v", err)
+	}
+
+	// Search index is only built for default branch, and built before rendering
+	// because rendering converts documentation to HTML. It's saved along with
+	// package info after rendering succeeds.
+	var terms []*models.PkgTerm
+	var exports []*models.PkgExport
+	if len(version) == 0 {
+		terms, exports = IndexTerms(pdoc), IndexExports(pdoc)
+	}
+
+	log.Info("Walked package: %s, Goroutine #%d", pdoc.DocPath(), runtime.NumGoroutine())
 
-	if err = renderDoc(render, pdoc, importPath); err != nil {
+	// Blobs are checked in between so nothing more is saved once canceled.
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err = renderDoc(ctx, render, pdoc); err != nil {
+		if err == ctx.Err() {
+			return nil, err
+		}
 		return nil, fmt.Errorf("render doc: %v", err)
 	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err = storage.Put(snapshotKey, snapshot); err != nil {
+		return nil, fmt.Errorf("save snapshot: %v", err)
+	}
+	pdoc.SnapshotKey = snapshotKey
 
 	if pinfo != nil {
 		pdoc.ID = pinfo.ID
-		pdoc.RefIDs = pinfo.RefIDs
 		pdoc.RefNum = pinfo.RefNum
 	}
 
+	setJobState(ctx, JOB_SAVING)
 	pdoc.Created = time.Now().UTC().Unix()
-	if err = models.SavePkgInfo(pdoc.PkgInfo, true); err != nil {
+	// Import references are only maintained for default branch.
+	if err = models.SavePkgInfo(pdoc.PkgInfo, len(version) == 0); err != nil {
 		return nil, fmt.Errorf("SavePkgInfo: %v", err)
 	}
 
+	if len(version) == 0 {
+		if err = models.SavePkgIndex(pdoc.ID, terms, exports); err != nil {
+			return nil, fmt.Errorf("SavePkgIndex: %v", err)
+		}
+	}
+
 	return pdoc.PkgInfo, nil
 }
@@ -0,0 +1,204 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"gopkg.in/ini.v1"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/setting"
+	"github.com/Unknwon/gowalker/modules/storage"
+)
+
+// newTestSnapshotEnv initializes storage in a temporary directory, where database
+// is configured as well, returned function removes the directory and restores
+// configuration.
+func newTestSnapshotEnv(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "gw-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldCfg := setting.Cfg
+	setting.Cfg, err = ini.Load([]byte(fmt.Sprintf(`[storage]
+TYPE = fs
+PATH = %s
+
+[database]
+TYPE = sqlite3
+PATH = %s
+`, path.Join(dir, "blobs"), path.Join(dir, "gowalker.db"))))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	storage.Init()
+
+	return func() {
+		setting.Cfg = oldCfg
+		os.RemoveAll(dir)
+	}
+}
+
+// newTestSnapshotPackage returns a package with every kind of field set.
+func newTestSnapshotPackage() *Package {
+	return &Package{
+		PkgInfo: &models.PkgInfo{
+			ImportPath: "github.com/user/pkg",
+			Synopsis:   "Package pkg does things.",
+			IsCmd:      true,
+		},
+		Readme: map[string][]byte{"en": []byte("# pkg")},
+		PkgDecl: &PkgDecl{
+			Tag: "v1.0.0",
+			Doc: "<p>Package pkg does things.</p>\n",
+			File: File{
+				Funcs: []*Func{{Name: "Hello", Doc: "Hello says hello.\n"}},
+				Types: []*Type{{
+					Name:    "Kind",
+					Methods: []*Func{{Name: "String"}},
+				}},
+			},
+			Imports: []string{"fmt", "github.com/user/dep"},
+			Dirs:    []string{"sub"},
+		},
+		IsHasExport: true,
+	}
+}
+
+// encodeTestSnapshot encodes package as snapshot of given version.
+func encodeTestSnapshot(t *testing.T, ver int, pdoc *Package) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	enc := gob.NewEncoder(gw)
+	if err := enc.Encode(ver); err != nil {
+		t.Fatal(err)
+	} else if err = enc.Encode(pdoc); err != nil {
+		t.Fatal(err)
+	} else if err = gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	defer newTestSnapshotEnv(t)()
+
+	pdoc := newTestSnapshotPackage()
+	blob, key, err := encodeSnapshot(pdoc)
+	if err != nil {
+		t.Fatal(err)
+	} else if err = storage.Put(key, blob); err != nil {
+		t.Fatal(err)
+	}
+	// Snapshot is keyed by its content.
+	if _, key2, err := encodeSnapshot(newTestSnapshotPackage()); err != nil {
+		t.Fatal(err)
+	} else if key2 != key {
+		t.Errorf("expect same key %s but got %s", key, key2)
+	}
+
+	got, err := loadSnapshot(&models.PkgInfo{SnapshotKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, pdoc) {
+		t.Errorf("expect %+v but got %+v", pdoc, got)
+	}
+}
+
+func TestDecodeSnapshot(t *testing.T) {
+	pdoc := newTestSnapshotPackage()
+	if got, err := decodeSnapshot(encodeTestSnapshot(t, SNAPSHOT_VER, pdoc)); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(got, pdoc) {
+		t.Errorf("expect %+v but got %+v", pdoc, got)
+	}
+
+	for _, ver := range []int{SNAPSHOT_VER - 1, SNAPSHOT_VER + 1} {
+		if _, err := decodeSnapshot(encodeTestSnapshot(t, ver, pdoc)); err != errSnapshotOutdated {
+			t.Errorf("version %d: expect %v but got %v", ver, errSnapshotOutdated, err)
+		}
+	}
+
+	blob := encodeTestSnapshot(t, SNAPSHOT_VER, pdoc)
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"not gzip":  []byte("not a snapshot"),
+		"truncated": blob[:len(blob)/2],
+	} {
+		if _, err := decodeSnapshot(data); err == nil {
+			t.Errorf("%s: expect error but got nil", name)
+		}
+	}
+}
+
+func TestLoadSnapshotReset(t *testing.T) {
+	defer newTestSnapshotEnv(t)()
+	models.Init()
+
+	corrupt := []byte("not a snapshot")
+	outdated := encodeTestSnapshot(t, SNAPSHOT_VER+1, newTestSnapshotPackage())
+	for _, data := range [][]byte{corrupt, outdated} {
+		if err := storage.Put(storage.Key(data), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		key string
+		err error
+	}{
+		"missing":  {storage.Key([]byte("missing")), storage.ErrNotExist},
+		"outdated": {storage.Key(outdated), errSnapshotOutdated},
+		"corrupt":  {storage.Key(corrupt), nil},
+	} {
+		pinfo := &models.PkgInfo{
+			ImportPath:  "github.com/user/" + name,
+			DocKey:      "doc",
+			SnapshotKey: tc.key,
+		}
+		if err := models.SavePkgInfo(pinfo, false); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		pdoc, err := loadSnapshot(pinfo)
+		if err == nil || pdoc != nil {
+			t.Errorf("%s: expect error but got %v", name, pdoc)
+		} else if tc.err != nil && err != tc.err {
+			t.Errorf("%s: expect %v but got %v", name, tc.err, err)
+		}
+		if pinfo.SnapshotKey != "" {
+			t.Errorf("%s: snapshot key is not cleared", name)
+		}
+
+		// Key is cleared in database as well, so next crawl fetches everything again.
+		if saved, err := models.GetPkgInfoById(pinfo.ID); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if saved.SnapshotKey != "" {
+			t.Errorf("%s: snapshot key %q is not cleared in database", name, saved.SnapshotKey)
+		}
+	}
+}
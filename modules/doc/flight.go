@@ -0,0 +1,92 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// flightCall represents an in-flight generation of a package.
+type flightCall struct {
+	done  chan struct{}
+	pinfo *models.PkgInfo
+	err   error
+
+	key     string
+	waiters int // Number of requests still waiting for the result.
+	cancel  context.CancelFunc
+}
+
+// flightGroup coalesces concurrent generations of the same package,
+// so only the first caller does the work and others wait for its result.
+type flightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do starts fn in background if there is no in-flight call of given key,
+// it returns the call and whether the caller is the leader who started it.
+// The context passed to fn is canceled once every waiting caller has left.
+func (g *flightGroup) do(key string, fn func(context.Context) (*models.PkgInfo, error)) (*flightCall, bool) {
+	g.lock.Lock()
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		g.lock.Unlock()
+		return c, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &flightCall{
+		done:    make(chan struct{}),
+		key:     key,
+		waiters: 1,
+		cancel:  cancel,
+	}
+	g.calls[key] = c
+	g.lock.Unlock()
+
+	go func() {
+		c.pinfo, c.err = fn(ctx)
+		cancel()
+
+		g.lock.Lock()
+		// Call could have been replaced if it was abandoned before.
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.lock.Unlock()
+		close(c.done)
+	}()
+	return c, true
+}
+
+// leave tells the call a caller is no longer waiting for it,
+// generation is canceled when nobody is waiting.
+func (g *flightGroup) leave(c *flightCall) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+
+	c.cancel()
+	if g.calls[c.key] == c {
+		delete(g.calls, c.key)
+	}
+}
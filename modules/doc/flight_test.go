@@ -0,0 +1,154 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// newTestFlight returns a function for flightGroup.do that sends its context
+// to given channel and blocks until it's canceled or release is closed.
+func newTestFlight(ctxs chan<- context.Context, release <-chan struct{}, calls *int32) func(context.Context) (*models.PkgInfo, error) {
+	return func(ctx context.Context) (*models.PkgInfo, error) {
+		atomic.AddInt32(calls, 1)
+		ctxs <- ctx
+		select {
+		case <-release:
+			return &models.PkgInfo{ImportPath: "github.com/user/pkg"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestFlightGroupShared(t *testing.T) {
+	g := &flightGroup{calls: make(map[string]*flightCall)}
+	ctxs := make(chan context.Context, 10)
+	release := make(chan struct{})
+	var calls int32
+
+	leader, isLeader := g.do("key", newTestFlight(ctxs, release, &calls))
+	if !isLeader {
+		t.Fatal("first caller is not the leader")
+	}
+	<-ctxs
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, isLeader := g.do("key", newTestFlight(ctxs, release, &calls))
+			if isLeader || c != leader {
+				t.Error("caller does not join the in-flight call")
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+	<-leader.done
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expect 1 call but got %d", n)
+	}
+	if leader.err != nil || leader.pinfo == nil {
+		t.Fatalf("unexpected result: %v, %v", leader.pinfo, leader.err)
+	}
+	if len(g.calls) != 0 {
+		t.Errorf("finished call is not removed: %v", g.calls)
+	}
+
+	// Finished call is not shared with later callers.
+	next := make(chan struct{})
+	c, isLeader := g.do("key", newTestFlight(ctxs, next, &calls))
+	<-ctxs
+	if !isLeader || c == leader {
+		t.Error("later caller joins the finished call")
+	}
+
+	// Callers leave the finished call after they got the result,
+	// which neither cancels nor removes the later call.
+	for i := 0; i < 6; i++ {
+		g.leave(leader)
+	}
+	g.lock.Lock()
+	removed := g.calls["key"] != c
+	g.lock.Unlock()
+	if removed {
+		t.Error("leaving the finished call removes the later one")
+	}
+	close(next)
+	<-c.done
+	if c.err != nil {
+		t.Errorf("unexpected error: %v", c.err)
+	}
+}
+
+func TestFlightGroupLeave(t *testing.T) {
+	g := &flightGroup{calls: make(map[string]*flightCall)}
+	ctxs := make(chan context.Context, 10)
+	release := make(chan struct{})
+	var calls int32
+
+	c, _ := g.do("key", newTestFlight(ctxs, release, &calls))
+	ctx := <-ctxs
+	g.do("key", newTestFlight(ctxs, release, &calls))
+
+	// Generation goes on as long as somebody is waiting.
+	g.leave(c)
+	if ctx.Err() != nil {
+		t.Fatal("call is canceled while a caller is still waiting")
+	}
+	if g.calls["key"] != c {
+		t.Fatal("call is removed while a caller is still waiting")
+	}
+
+	g.leave(c)
+	if ctx.Err() == nil {
+		t.Fatal("call is not canceled after the last caller left")
+	}
+	if g.calls["key"] != nil {
+		t.Fatal("abandoned call is not removed")
+	}
+
+	// New caller starts over instead of joining the abandoned call,
+	// which must not remove the new one when it finishes.
+	next, isLeader := g.do("key", newTestFlight(ctxs, release, &calls))
+	if !isLeader || next == c {
+		t.Fatal("new caller joins the abandoned call")
+	}
+	<-ctxs
+	<-c.done
+	if c.err != context.Canceled {
+		t.Errorf("expect %v but got %v", context.Canceled, c.err)
+	}
+	g.lock.Lock()
+	replaced := g.calls["key"] != next
+	g.lock.Unlock()
+	if replaced {
+		t.Error("abandoned call removes the new one")
+	}
+
+	close(release)
+	<-next.done
+	if next.err != nil {
+		t.Errorf("unexpected error: %v", next.err)
+	}
+}
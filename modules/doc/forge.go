@@ -0,0 +1,173 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Unknwon/com"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/base"
+)
+
+// Helpers shared by services of code forges that have REST APIs,
+// i.e. GitLab, Gitea and Bitbucket.
+
+var errForgeNotFound = errors.New("Forge resource not found")
+
+// forgeRoot returns import path prefix of forge at given base URL,
+// e.g. "git.example.com" for "https://git.example.com/".
+func forgeRoot(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	} else if len(u.Host) == 0 {
+		return "", fmt.Errorf("no host in URL: %s", baseURL)
+	}
+	return u.Host + strings.TrimSuffix(u.Path, "/"), nil
+}
+
+// forgePattern returns pattern of import paths of repositories on forge of given root.
+func forgePattern(root string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(root) + `/(?P<owner>[a-z0-9A-Z_.\-]+)/(?P<repo>[a-z0-9A-Z_.\-]+)(?P<dir>/[a-z0-9A-Z_.\-/]*)?$`)
+}
+
+// escapePath escapes every segment of given path to be used in URL.
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// getForgeBytes gets the resource with given header,
+// it returns errForgeNotFound if the server responds with status 404.
+func getForgeBytes(client *http.Client, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", com.UserAgent)
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		return ioutil.ReadAll(resp.Body)
+	case 404:
+		return nil, errForgeNotFound
+	}
+	return nil, fmt.Errorf("GET %s -> %d", url, resp.StatusCode)
+}
+
+// getForgeJSON gets the resource with given header and decodes it as JSON.
+func getForgeJSON(client *http.Client, url string, header http.Header, v interface{}) error {
+	data, err := getForgeBytes(client, url, header)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// splitTree returns paths of files in the directory of import path and
+// names of its direct sub-directories that have files, from paths of all
+// files in the repository. Directory is either empty or starts with "/".
+func splitTree(blobs []string, dir string) (files, dirs []string) {
+	dirPrefix := dir
+	if dirPrefix != "" {
+		dirPrefix = dirPrefix[1:] + "/"
+	}
+
+	dirMap := make(map[string]bool)
+	for _, blob := range blobs {
+		if !strings.HasPrefix(blob, dirPrefix) {
+			continue
+		}
+
+		d, f := path.Split(blob)
+		if !base.IsDocFile(f) {
+			continue
+		}
+		if d == dirPrefix {
+			files = append(files, blob)
+		} else if sub := strings.TrimSuffix(d[len(dirPrefix):], "/"); !strings.Contains(sub, "/") {
+			dirMap[sub] = true
+		}
+	}
+	return files, base.MapToSortedStrings(dirMap)
+}
+
+// fetchForgeFiles fetches source files in parallel with given header.
+func fetchForgeFiles(client *http.Client, srcs []*Source, header http.Header) error {
+	ch := make(chan error, len(srcs))
+	for i := range srcs {
+		go func(src *Source) {
+			data, err := getForgeBytes(client, src.RawSrcUrl, header)
+			if err == nil {
+				src.SrcData = data
+			}
+			ch <- err
+		}(srcs[i])
+	}
+	for range srcs {
+		if err := <-ch; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkForgeDoc fetches source files and generates documentation of package.
+func walkForgeDoc(ctx context.Context, client *http.Client, header http.Header,
+	pinfo *models.PkgInfo, lineFmt string, srcs []*Source) (*Package, error) {
+
+	setJobFiles(ctx, JOB_DOWNLOADING, len(srcs))
+	if err := fetchForgeFiles(client, srcs, header); err != nil {
+		return nil, fmt.Errorf("fetch files: %v", err)
+	}
+
+	w := &Walker{
+		LineFmt: lineFmt,
+		Pdoc: &Package{
+			PkgInfo: pinfo,
+		},
+	}
+
+	setJobState(ctx, JOB_WALKING)
+	pdoc, err := w.Build(&WalkRes{
+		WalkDepth: WD_All,
+		WalkType:  WT_Memory,
+		WalkMode:  WM_All,
+		Srcs:      srcs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking package: %v", err)
+	}
+	return pdoc, nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// gitea represents a Gitea or Gogs instance, they share the same API.
+type gitea struct {
+	baseURL string
+	root    string // Import path prefix.
+	token   string
+}
+
+// newGiteaService returns service of Gitea or Gogs instance at given base URL.
+func newGiteaService(baseURL, token string) (*service, error) {
+	root, err := forgeRoot(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gitea{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		root:    root,
+		token:   token,
+	}
+	return &service{forgePattern(root), root + "/", g.getDoc}, nil
+}
+
+// dirTreeSHA returns SHA of tree of given directory in the tree of given SHA,
+// by walking down one level at a time so the whole tree is never listed.
+// It returns ErrPackageNoGoFile if the directory does not exist.
+func (g *gitea) dirTreeSHA(client *http.Client, api string, header http.Header, sha, dir string) (string, error) {
+	for _, name := range strings.Split(dir, "/") {
+		found := false
+		for page := 1; !found; page++ {
+			var tree struct {
+				Tree []struct {
+					Path string `json:"path"`
+					Type string `json:"type"`
+					SHA  string `json:"sha"`
+				} `json:"tree"`
+				Truncated bool `json:"truncated"`
+			}
+			if err := getForgeJSON(client, fmt.Sprintf("%s/git/trees/%s?page=%d",
+				api, url.PathEscape(sha), page), header, &tree); err != nil {
+				return "", fmt.Errorf("get tree: %v", err)
+			}
+
+			for _, node := range tree.Tree {
+				if node.Type == "tree" && node.Path == name {
+					sha, found = node.SHA, true
+					break
+				}
+			}
+			if !found && !tree.Truncated {
+				return "", ErrPackageNoGoFile
+			}
+		}
+	}
+	return sha, nil
+}
+
+// getDoc generates documentation from Gitea API v1.
+// It returns ErrNoServiceMatch if the repository is not found.
+func (g *gitea) getDoc(ctx context.Context, match map[string]string, etag string) (*Package, error) {
+	client := newClient(ctx)
+	header := http.Header{}
+	if len(g.token) > 0 {
+		header.Set("Authorization", "token "+g.token)
+	}
+
+	repoPath := match["owner"] + "/" + match["repo"]
+	api := g.baseURL + "/api/v1/repos/" + repoPath
+
+	var repoInfo struct {
+		DefaultBranch string `json:"default_branch"`
+		Stars         int64  `json:"stars_count"`
+		Fork          bool   `json:"fork"`
+	}
+	if err := getForgeJSON(client, api, header, &repoInfo); err == errForgeNotFound {
+		return nil, ErrNoServiceMatch
+	} else if err != nil {
+		return nil, fmt.Errorf("get repository: %v", err)
+	}
+
+	// Set default branch if not presented.
+	if len(match["tag"]) == 0 {
+		match["tag"] = repoInfo.DefaultBranch
+	}
+
+	// Tags are used for both version switcher and revision check.
+	var tags []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if err := getForgeJSON(client, api+"/tags?limit=100", header, &tags); err != nil {
+		// Tags are optional, revision is still checked by branch or commit.
+		log.Warn("Fail to get tags of %s: %v", match["importPath"], err)
+		tags = nil
+	}
+
+	// Check revision, tag is either a branch, a tag or a commit.
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	err := getForgeJSON(client, api+"/branches/"+url.PathEscape(match["tag"]), header, &branch)
+	if err != nil && err != errForgeNotFound {
+		return nil, fmt.Errorf("get branch: %v", err)
+	}
+	commit := branch.Commit.ID
+	if len(commit) == 0 {
+		commit = match["tag"]
+		for _, t := range tags {
+			if t.Name == match["tag"] {
+				commit = t.Commit.SHA
+				break
+			}
+		}
+	}
+	if commit == etag {
+		return nil, ErrPackageNotModified
+	}
+
+	// Get files, tree is paginated and only listed under the directory.
+	treeSHA, prefix := commit, ""
+	if len(match["dir"]) > 0 {
+		if treeSHA, err = g.dirTreeSHA(client, api, header, commit, match["dir"][1:]); err != nil {
+			return nil, err
+		}
+		prefix = match["dir"][1:] + "/"
+	}
+	blobs := make([]string, 0, 10)
+	for page := 1; ; page++ {
+		var tree struct {
+			Tree []struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+			} `json:"tree"`
+			Truncated bool `json:"truncated"`
+		}
+		if err = getForgeJSON(client, fmt.Sprintf("%s/git/trees/%s?recursive=true&page=%d",
+			api, url.PathEscape(treeSHA), page), header, &tree); err != nil {
+			return nil, fmt.Errorf("get tree: %v", err)
+		}
+
+		for _, node := range tree.Tree {
+			if node.Type == "blob" {
+				blobs = append(blobs, prefix+node.Path)
+			}
+		}
+		if !tree.Truncated {
+			break
+		}
+	}
+
+	files, dirs := splitTree(blobs, match["dir"])
+	if len(files) == 0 && len(dirs) == 0 {
+		return nil, ErrPackageNoGoFile
+	}
+
+	projectURL := g.root + "/" + repoPath
+	srcs := make([]*Source, 0, len(files))
+	for _, f := range files {
+		srcs = append(srcs, &Source{
+			SrcName:   path.Base(f),
+			BrowseUrl: projectURL + "/src/" + commit + "/" + f,
+			RawSrcUrl: api + "/raw/" + url.PathEscape(commit) + escapePath("/"+f),
+		})
+	}
+
+	pdoc, err := walkForgeDoc(ctx, client, header, &models.PkgInfo{
+		ImportPath:  match["importPath"],
+		ProjectPath: projectURL,
+		ViewDirPath: projectURL + "/src/" + match["tag"] + match["dir"],
+		Etag:        commit,
+		Subdirs:     strings.Join(dirs, "|"),
+		IsFork:      repoInfo.Fork,
+	}, "#L%d", srcs)
+	if err != nil {
+		return nil, err
+	}
+	pdoc.Stars = repoInfo.Stars
+
+	tagNames := make([]string, len(tags))
+	for i := range tags {
+		tagNames[i] = tags[i].Name
+	}
+	pdoc.Tags = strings.Join(tagNames, "|")
+
+	return pdoc, nil
+}
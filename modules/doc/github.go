@@ -16,8 +16,10 @@ package doc
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"path"
 	"regexp"
@@ -25,34 +27,60 @@ import (
 	"time"
 
 	"github.com/Unknwon/com"
+	"github.com/Unknwon/log"
 
 	"github.com/Unknwon/gowalker/models"
 	"github.com/Unknwon/gowalker/modules/base"
-	"github.com/Unknwon/gowalker/modules/setting"
 )
 
 var (
-	githubRawHeader       = http.Header{"Accept": {"application/vnd.github-blob.raw"}}
-	githubRevisionPattern = regexp.MustCompile(`data-clipboard-text="[a-z0-9A-Z]+`)
-	githubPattern         = regexp.MustCompile(`^github\.com/(?P<owner>[a-z0-9A-Z_.\-]+)/(?P<repo>[a-z0-9A-Z_.\-]+)(?P<dir>/[a-z0-9A-Z_.\-/]*)?$`)
+	githubAPIURL     = "https://api.github.com"
+	githubRawHeader  = http.Header{"Accept": {"application/vnd.github-blob.raw"}}
+	githubSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	githubPattern    = regexp.MustCompile(`^github\.com/(?P<owner>[a-z0-9A-Z_.\-]+)/(?P<repo>[a-z0-9A-Z_.\-]+)(?P<dir>/[a-z0-9A-Z_.\-/]*)?$`)
 )
 
-func getGithubRevision(importPath, tag string) (string, error) {
-	data, err := com.HttpGetBytes(Client, fmt.Sprintf("https://%s/commits/"+tag, importPath), nil)
+// getGithubRevision returns commit SHA of given branch, tag or commit through the API.
+// Saved etag is the commit SHA of last time, it's sent for conditional request
+// which does not count against rate limit, and ErrPackageNotModified is returned
+// if the commit has not changed.
+func getGithubRevision(ctx context.Context, owner, repo, tag, etag string) (string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/repos/%s/%s/commits/%s", githubAPIURL, owner, repo, tag), nil)
 	if err != nil {
-		return "", fmt.Errorf("fetch revision page: %v", err)
+		return "", err
+	}
+	req.Header.Set("User-Agent", com.UserAgent)
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", `"`+etag+`"`)
+	}
+
+	resp, err := newGithubClient(ctx).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case 304:
+		return "", ErrPackageNotModified
+	case 404, 422:
+		// Unknown ref is unprocessable entity.
+		return "", com.NotFoundError{"Revision not found: " + tag}
+	default:
+		return "", fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
-	i := bytes.Index(data, []byte(`btn-outline`))
-	if i == -1 {
-		return "", errors.New("find revision locater: not found")
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
 	}
-	data = data[i+1:]
-	m := githubRevisionPattern.FindSubmatch(data)
-	if m == nil {
-		return "", fmt.Errorf("find revision: not found")
+	commit := string(bytes.TrimSpace(data))
+	if !githubSHAPattern.MatchString(commit) {
+		return "", fmt.Errorf("unexpected commit SHA: %.50q", commit)
 	}
-	return strings.TrimPrefix(string(m[0]), `data-clipboard-text="`), nil
+	return commit, nil
 }
 
 type RepoInfo struct {
@@ -71,11 +99,11 @@ type RepoCommit struct {
 	} `json:"commit"`
 }
 
-func getGithubDoc(match map[string]string, etag string) (_ *Package, err error) {
-	match["cred"] = setting.GitHubCredentials
+func getGithubDoc(ctx context.Context, match map[string]string, etag string) (_ *Package, err error) {
+	client := newGithubClient(ctx)
 
 	repoInfo := new(RepoInfo)
-	if err := com.HttpGetJSON(Client, com.Expand("https://api.github.com/repos/{owner}/{repo}?{cred}", match), repoInfo); err != nil {
+	if err := com.HttpGetJSON(client, com.Expand("https://api.github.com/repos/{owner}/{repo}", match), repoInfo); err != nil {
 		return nil, fmt.Errorf("get repo default branch: %v", err)
 	}
 
@@ -86,9 +114,9 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 
 	// Check if last commit time is behind upstream for fork repository.
 	if repoInfo.Fork {
-		url := com.Expand("https://api.github.com/repos/{owner}/{repo}/commits?per_page=1&{cred}", match)
+		url := com.Expand("https://api.github.com/repos/{owner}/{repo}/commits?per_page=1", match)
 		forkCommits := make([]*RepoCommit, 0, 1)
-		if err := com.HttpGetJSON(Client, url, &forkCommits); err != nil {
+		if err := com.HttpGetJSON(client, url, &forkCommits); err != nil {
 			return nil, fmt.Errorf("get fork repository commits: %v", err)
 		}
 		if len(forkCommits) == 0 {
@@ -96,9 +124,9 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 		}
 
 		match["parent"] = repoInfo.Parent.FullName
-		url = com.Expand("https://api.github.com/repos/{parent}/commits?per_page=1&{cred}", match)
+		url = com.Expand("https://api.github.com/repos/{parent}/commits?per_page=1", match)
 		parentCommits := make([]*RepoCommit, 0, 1)
-		if err := com.HttpGetJSON(Client, url, &parentCommits); err != nil {
+		if err := com.HttpGetJSON(client, url, &parentCommits); err != nil {
 			return nil, fmt.Errorf("get parent repository commits: %v", err)
 		}
 		if len(parentCommits) == 0 {
@@ -118,7 +146,7 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 			Sha string `json:"sha"`
 		}
 
-		if err := com.HttpGetJSON(Client,
+		if err := com.HttpGetJSON(client,
 			com.Expand("https://gopm.io/api/v1/revision?pkgname={importPath}", match), &obj); err != nil {
 			return nil, fmt.Errorf("get gopkg.in revision: %v", err)
 		}
@@ -127,13 +155,12 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 		match["tag"] = commit
 		fmt.Println(commit)
 	} else {
-		commit, err = getGithubRevision(com.Expand("github.com/{owner}/{repo}", match), match["tag"])
-		if err != nil {
+		commit, err = getGithubRevision(ctx, match["owner"], match["repo"], match["tag"], etag)
+		if err == ErrPackageNotModified {
+			return nil, err
+		} else if err != nil {
 			return nil, fmt.Errorf("get revision: %v", err)
 		}
-		if commit == etag {
-			return nil, ErrPackageNotModified
-		}
 	}
 
 	// Get files.
@@ -146,8 +173,8 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 		Url string
 	}
 
-	if err := com.HttpGetJSON(Client,
-		com.Expand("https://api.github.com/repos/{owner}/{repo}/git/trees/{tag}?recursive=1&{cred}", match), &tree); err != nil {
+	if err := com.HttpGetJSON(client,
+		com.Expand("https://api.github.com/repos/{owner}/{repo}/git/trees/{tag}?recursive=1", match), &tree); err != nil {
 		return nil, fmt.Errorf("get tree: %v", err)
 	}
 
@@ -180,7 +207,7 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 				files = append(files, &Source{
 					SrcName:   f,
 					BrowseUrl: com.Expand("github.com/{owner}/{repo}/blob/{tag}/{0}", match, node.Path),
-					RawSrcUrl: com.Expand("https://raw.github.com/{owner}/{repo}/{tag}/{0}?{1}", match, node.Path, setting.GitHubCredentials),
+					RawSrcUrl: com.Expand("https://raw.github.com/{owner}/{repo}/{tag}/{0}", match, node.Path),
 				})
 				continue
 			}
@@ -197,7 +224,9 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 
 	if len(files) == 0 && len(dirs) == 0 {
 		return nil, ErrPackageNoGoFile
-	} else if err := com.FetchFiles(Client, files, githubRawHeader); err != nil {
+	}
+	setJobFiles(ctx, JOB_DOWNLOADING, len(files))
+	if err := com.FetchFiles(client, files, githubRawHeader); err != nil {
 		return nil, fmt.Errorf("fetch files: %v", err)
 	}
 
@@ -212,6 +241,7 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 				ViewDirPath: com.Expand("github.com/{owner}/{repo}/tree/{tag}/{importPath}", match),
 				Etag:        commit,
 				Subdirs:     strings.Join(dirs, "|"),
+				IsFork:      repoInfo.Fork,
 			},
 		},
 	}
@@ -227,6 +257,7 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 		}
 	}
 
+	setJobState(ctx, JOB_WALKING)
 	pdoc, err := w.Build(&WalkRes{
 		WalkDepth: WD_All,
 		WalkType:  WT_Memory,
@@ -241,11 +272,26 @@ func getGithubDoc(match map[string]string, etag string) (_ *Package, err error)
 	var repoTree struct {
 		Stars int64 `json:"watchers"`
 	}
-	if err := com.HttpGetJSON(Client,
-		com.Expand("https://api.github.com/repos/{owner}/{repo}?{cred}", match), &repoTree); err != nil {
+	if err := com.HttpGetJSON(client,
+		com.Expand("https://api.github.com/repos/{owner}/{repo}", match), &repoTree); err != nil {
 		return nil, fmt.Errorf("get repoTree: %v", err)
 	}
 	pdoc.Stars = repoTree.Stars
 
+	// Get tags for version switcher.
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	if err := com.HttpGetJSON(client,
+		com.Expand("https://api.github.com/repos/{owner}/{repo}/tags?per_page=100", match), &tags); err != nil {
+		// Tags are optional, documentation is still useful without them.
+		log.Warn("Fail to get tags of %s: %v", match["importPath"], err)
+	}
+	tagNames := make([]string, len(tags))
+	for i := range tags {
+		tagNames[i] = tags[i].Name
+	}
+	pdoc.Tags = strings.Join(tagNames, "|")
+
 	return pdoc, nil
 }
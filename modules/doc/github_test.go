@@ -0,0 +1,118 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Unknwon/com"
+)
+
+const (
+	testSHA    = "0123456789abcdef0123456789abcdef01234567"
+	testOldSHA = "76543210fedcba9876543210fedcba9876543210"
+)
+
+// newGithubServer serves canned responses of commit SHA of refs in the same
+// way as GitHub API, the SHA is the ETag and conditional request is supported.
+func newGithubServer(t *testing.T, refs map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.github.sha" {
+			t.Errorf("unexpected Accept header: %s", r.Header.Get("Accept"))
+		}
+
+		const prefix = "/repos/unknwon/hello/commits/"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		ref := strings.TrimPrefix(r.URL.Path, prefix)
+		if ref == "broken" {
+			w.WriteHeader(500)
+			return
+		} else if ref == "html" {
+			w.Write([]byte("<html>Unicorn!</html>"))
+			return
+		}
+
+		sha, ok := refs[ref]
+		if !ok {
+			w.WriteHeader(422)
+			w.Write([]byte(`{"message":"No commit found for SHA: ` + ref + `"}`))
+			return
+		}
+
+		etag := `"` + sha + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(304)
+			return
+		}
+		w.Write([]byte(sha))
+	}))
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(com.NotFoundError)
+	return ok
+}
+
+func TestGetGithubRevision(t *testing.T) {
+	ts := newGithubServer(t, map[string]string{
+		"master": testSHA,
+		"v1.0.0": testOldSHA,
+	})
+	defer ts.Close()
+
+	oldURL := githubAPIURL
+	githubAPIURL = ts.URL
+	defer func() { githubAPIURL = oldURL }()
+
+	for _, c := range []struct {
+		tag, etag string
+		expect    string
+		expectErr error
+	}{
+		{"master", "", testSHA, nil},
+		{"master", testOldSHA, testSHA, nil},
+		{"master", testSHA, "", ErrPackageNotModified},
+		{"v1.0.0", testSHA, testOldSHA, nil},
+		{"v1.0.0", testOldSHA, "", ErrPackageNotModified},
+	} {
+		commit, err := getGithubRevision(context.Background(), "unknwon", "hello", c.tag, c.etag)
+		if err != c.expectErr || commit != c.expect {
+			t.Errorf("getGithubRevision(%s, %s): expect %q, %v but got %q, %v",
+				c.tag, c.etag, c.expect, c.expectErr, commit, err)
+		}
+	}
+
+	// Unknown ref and repository.
+	for _, owner := range []string{"unknwon", "nobody"} {
+		if _, err := getGithubRevision(context.Background(), owner, "hello", "nope", ""); !isNotFound(err) {
+			t.Errorf("%s: expect not found error but got: %v", owner, err)
+		}
+	}
+
+	// Server error and unexpected content.
+	for _, tag := range []string{"broken", "html"} {
+		if commit, err := getGithubRevision(context.Background(), "unknwon", "hello", tag, ""); err == nil {
+			t.Errorf("%s: expect error but got: %s", tag, commit)
+		}
+	}
+}
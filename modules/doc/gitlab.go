@@ -0,0 +1,160 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// gitlab represents a GitLab instance.
+type gitlab struct {
+	baseURL string
+	root    string // Import path prefix.
+	token   string
+}
+
+// newGitlabService returns service of GitLab instance at given base URL.
+func newGitlabService(baseURL, token string) (*service, error) {
+	root, err := forgeRoot(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gitlab{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		root:    root,
+		token:   token,
+	}
+	return &service{forgePattern(root), root + "/", g.getDoc}, nil
+}
+
+// getDoc generates documentation from GitLab API v4.
+// It returns ErrNoServiceMatch if the project is not found, projects in
+// nested groups are resolved by go-get meta tag and cloned.
+func (g *gitlab) getDoc(ctx context.Context, match map[string]string, etag string) (*Package, error) {
+	client := newClient(ctx)
+	header := http.Header{}
+	if len(g.token) > 0 {
+		header.Set("PRIVATE-TOKEN", g.token)
+	}
+
+	projectPath := match["owner"] + "/" + match["repo"]
+	api := g.baseURL + "/api/v4/projects/" + url.PathEscape(projectPath)
+
+	var project struct {
+		DefaultBranch string    `json:"default_branch"`
+		StarCount     int64     `json:"star_count"`
+		ForkedFrom    *struct{} `json:"forked_from_project"`
+	}
+	if err := getForgeJSON(client, api, header, &project); err == errForgeNotFound {
+		return nil, ErrNoServiceMatch
+	} else if err != nil {
+		return nil, fmt.Errorf("get project: %v", err)
+	}
+
+	// Set default branch if not presented.
+	if len(match["tag"]) == 0 {
+		match["tag"] = project.DefaultBranch
+	}
+
+	// Check revision.
+	var commit struct {
+		ID string `json:"id"`
+	}
+	if err := getForgeJSON(client, api+"/repository/commits/"+url.PathEscape(match["tag"]), header, &commit); err != nil {
+		return nil, fmt.Errorf("get revision: %v", err)
+	}
+	if commit.ID == etag {
+		return nil, ErrPackageNotModified
+	}
+
+	// Get files, tree is paginated and only listed under the directory.
+	treeURL := fmt.Sprintf("%s/repository/tree?recursive=true&per_page=100&ref=%s", api, commit.ID)
+	if len(match["dir"]) > 0 {
+		treeURL += "&path=" + url.QueryEscape(match["dir"][1:])
+	}
+	blobs := make([]string, 0, 10)
+	for page := 1; ; page++ {
+		var nodes []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		}
+		if err := getForgeJSON(client, fmt.Sprintf("%s&page=%d", treeURL, page), header, &nodes); err != nil {
+			return nil, fmt.Errorf("get tree: %v", err)
+		}
+
+		for _, node := range nodes {
+			if node.Type == "blob" {
+				blobs = append(blobs, node.Path)
+			}
+		}
+		if len(nodes) < 100 {
+			break
+		}
+	}
+
+	files, dirs := splitTree(blobs, match["dir"])
+	if len(files) == 0 && len(dirs) == 0 {
+		return nil, ErrPackageNoGoFile
+	}
+
+	projectURL := g.root + "/" + projectPath
+	srcs := make([]*Source, 0, len(files))
+	for _, f := range files {
+		srcs = append(srcs, &Source{
+			SrcName:   path.Base(f),
+			BrowseUrl: projectURL + "/-/blob/" + commit.ID + "/" + f,
+			RawSrcUrl: api + "/repository/files/" + url.PathEscape(f) + "/raw?ref=" + commit.ID,
+		})
+	}
+
+	pdoc, err := walkForgeDoc(ctx, client, header, &models.PkgInfo{
+		ImportPath:  match["importPath"],
+		ProjectPath: projectURL,
+		ViewDirPath: projectURL + "/-/tree/" + match["tag"] + match["dir"],
+		Etag:        commit.ID,
+		Subdirs:     strings.Join(dirs, "|"),
+		IsFork:      project.ForkedFrom != nil,
+	}, "#L%d", srcs)
+	if err != nil {
+		return nil, err
+	}
+	pdoc.Stars = project.StarCount
+
+	// Get tags for version switcher.
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	if err = getForgeJSON(client, api+"/repository/tags?per_page=100", header, &tags); err != nil {
+		// Tags are optional, documentation is still useful without them.
+		log.Warn("Fail to get tags of %s: %v", match["importPath"], err)
+	}
+	tagNames := make([]string, len(tags))
+	for i := range tags {
+		tagNames[i] = tags[i].Name
+	}
+	pdoc.Tags = strings.Join(tagNames, "|")
+
+	return pdoc, nil
+}
@@ -15,6 +15,7 @@
 package doc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path"
@@ -24,7 +25,6 @@ import (
 
 	"github.com/Unknwon/gowalker/models"
 	"github.com/Unknwon/gowalker/modules/base"
-	"github.com/Unknwon/gowalker/modules/setting"
 )
 
 var (
@@ -32,19 +32,23 @@ var (
 	ErrPackageNoGoFile    = errors.New("Package does not contain Go file")
 )
 
-func getGolangDoc(importPath, etag string) (*Package, error) {
+func getGolangDoc(ctx context.Context, importPath, tag, etag string) (*Package, error) {
+	if len(tag) == 0 {
+		tag = "master"
+	}
 	match := map[string]string{
-		"cred": setting.GitHubCredentials,
+		"tag": tag,
 	}
 
+	client := newGithubClient(ctx)
+
 	// Check revision.
-	commit, err := getGithubRevision("github.com/golang/go", "master")
-	if err != nil {
+	commit, err := getGithubRevision(ctx, "golang", "go", tag, etag)
+	if err == ErrPackageNotModified {
+		return nil, err
+	} else if err != nil {
 		return nil, fmt.Errorf("get revision: %v", err)
 	}
-	if commit == etag {
-		return nil, ErrPackageNotModified
-	}
 
 	// Get files.
 	var tree struct {
@@ -56,8 +60,8 @@ func getGolangDoc(importPath, etag string) (*Package, error) {
 		Url string
 	}
 
-	if err := com.HttpGetJSON(Client,
-		com.Expand("https://api.github.com/repos/golang/go/git/trees/master?recursive=1&{cred}", match), &tree); err != nil {
+	if err := com.HttpGetJSON(client,
+		com.Expand("https://api.github.com/repos/golang/go/git/trees/{tag}?recursive=1", match), &tree); err != nil {
 		return nil, fmt.Errorf("get tree: %v", err)
 	}
 
@@ -79,8 +83,8 @@ func getGolangDoc(importPath, etag string) (*Package, error) {
 			if d == dirPrefix {
 				files = append(files, &Source{
 					SrcName:   f,
-					BrowseUrl: com.Expand("github.com/golang/go/blob/master/{0}", nil, node.Path),
-					RawSrcUrl: com.Expand("https://raw.github.com/golang/go/master/{0}?{1}", nil, node.Path, setting.GitHubCredentials),
+					BrowseUrl: com.Expand("github.com/golang/go/blob/{tag}/{0}", match, node.Path),
+					RawSrcUrl: com.Expand("https://raw.github.com/golang/go/{tag}/{0}", match, node.Path),
 				})
 				continue
 			}
@@ -97,7 +101,9 @@ func getGolangDoc(importPath, etag string) (*Package, error) {
 
 	if len(files) == 0 && len(dirs) == 0 {
 		return nil, ErrPackageNoGoFile
-	} else if err := com.FetchFiles(Client, files, githubRawHeader); err != nil {
+	}
+	setJobFiles(ctx, JOB_DOWNLOADING, len(files))
+	if err := com.FetchFiles(client, files, githubRawHeader); err != nil {
 		return nil, fmt.Errorf("fetch files: %v", err)
 	}
 
@@ -108,7 +114,7 @@ func getGolangDoc(importPath, etag string) (*Package, error) {
 			PkgInfo: &models.PkgInfo{
 				ImportPath:  importPath,
 				ProjectPath: "github.com/golang/go",
-				ViewDirPath: "github.com/golang/go/tree/master/src/" + importPath,
+				ViewDirPath: "github.com/golang/go/tree/" + tag + "/src/" + importPath,
 				Etag:        commit,
 				IsGoRepo:    true,
 				Subdirs:     strings.Join(dirs, "|"),
@@ -127,6 +133,7 @@ func getGolangDoc(importPath, etag string) (*Package, error) {
 		}
 	}
 
+	setJobState(ctx, JOB_WALKING)
 	pdoc, err := w.Build(&WalkRes{
 		WalkDepth: WD_All,
 		WalkType:  WT_Memory,
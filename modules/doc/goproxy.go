@@ -0,0 +1,191 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+var (
+	errModuleNotFound = errors.New("Module does not exist in proxy")
+	goproxyPattern    = regexp.MustCompile(`^(?P<host>[a-z0-9.\-]+\.[a-z0-9.\-]+(?::[0-9]+)?)(?P<dir>/[A-Za-z0-9_.\-/~+]*)?$`)
+)
+
+// proxyInfo represents response of version info query.
+type proxyInfo struct {
+	Version string
+	Time    time.Time
+}
+
+// getProxyBytes fetches given path of module from proxy.
+// It returns errModuleNotFound if the proxy responds with status 404 or 410.
+func getProxyBytes(ctx context.Context, modPath, file string) ([]byte, error) {
+	url := setting.GoProxyURL + "/" + escapeModulePath(modPath) + "/" + file
+	resp, err := newClient(ctx).Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusNotFound, http.StatusGone:
+		return nil, errModuleNotFound
+	}
+	return nil, fmt.Errorf("GET %s -> %d", url, resp.StatusCode)
+}
+
+func getProxyInfo(ctx context.Context, modPath, query string) (*proxyInfo, error) {
+	data, err := getProxyBytes(ctx, modPath, query)
+	if err != nil {
+		return nil, err
+	}
+	info := new(proxyInfo)
+	if err = json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("decode info: %v", err)
+	}
+	return info, nil
+}
+
+// latestVersion returns the latest release version,
+// or the latest pre-release version if there is no release.
+func latestVersion(versions []string) string {
+	var latest, latestPre string
+	for _, ver := range versions {
+		if _, pre := parseVersion(ver); len(pre) > 0 {
+			if len(latestPre) == 0 || compareVersion(ver, latestPre) > 0 {
+				latestPre = ver
+			}
+			continue
+		}
+		if len(latest) == 0 || compareVersion(ver, latest) > 0 {
+			latest = ver
+		}
+	}
+	if len(latest) == 0 {
+		return latestPre
+	}
+	return latest
+}
+
+// versionSlice sorts versions from the latest to the oldest.
+type versionSlice []string
+
+func (s versionSlice) Len() int           { return len(s) }
+func (s versionSlice) Less(i, j int) bool { return compareVersion(s[i], s[j]) > 0 }
+func (s versionSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func sortVersions(versions []string) []string {
+	sort.Sort(versionSlice(versions))
+	return versions
+}
+
+// findProxyModule returns the module path that provides given import path,
+// info of given version or the latest version if not specified, and all known versions.
+func findProxyModule(ctx context.Context, importPath, version string) (string, *proxyInfo, []string, error) {
+	for modPath := importPath; strings.Contains(modPath, "/"); modPath = path.Dir(modPath) {
+		data, err := getProxyBytes(ctx, modPath, "@v/list")
+		if err == errModuleNotFound {
+			continue
+		} else if err != nil {
+			return "", nil, nil, fmt.Errorf("list versions: %v", err)
+		}
+
+		versions := strings.Fields(string(data))
+		if len(version) == 0 {
+			version = latestVersion(versions)
+		}
+
+		var info *proxyInfo
+		if len(version) == 0 {
+			info, err = getProxyInfo(ctx, modPath, "@latest")
+		} else {
+			info, err = getProxyInfo(ctx, modPath, "@v/"+escapeModulePath(version)+".info")
+		}
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("get version info: %v", err)
+		}
+		return modPath, info, versions, nil
+	}
+	return "", nil, nil, errModuleNotFound
+}
+
+// getGoProxyDoc generates documentation from module archive served by GOPROXY.
+// It returns ErrNoServiceMatch if the proxy is disabled or the module is not found.
+func getGoProxyDoc(ctx context.Context, match map[string]string, etag string) (*Package, error) {
+	if len(setting.GoProxyURL) == 0 {
+		return nil, ErrNoServiceMatch
+	}
+
+	importPath := match["importPath"]
+	modPath, info, versions, err := findProxyModule(ctx, importPath, match["tag"])
+	if err == errModuleNotFound {
+		return nil, ErrNoServiceMatch
+	} else if err != nil {
+		return nil, err
+	}
+
+	if info.Version == etag {
+		return nil, ErrPackageNotModified
+	}
+
+	setJobState(ctx, JOB_DOWNLOADING)
+	data, err := getProxyBytes(ctx, modPath, "@v/"+escapeModulePath(info.Version)+".zip")
+	if err != nil {
+		return nil, fmt.Errorf("get module archive: %v", err)
+	}
+
+	// Start generating data.
+	w := &Walker{
+		LineFmt: "#L%d",
+		Pdoc: &Package{
+			PkgInfo: &models.PkgInfo{
+				ImportPath:  importPath,
+				ProjectPath: modPath,
+				Etag:        info.Version,
+				Tags:        strings.Join(sortVersions(versions), "|"),
+			},
+		},
+	}
+
+	setJobState(ctx, JOB_WALKING)
+	pdoc, err := w.Build(&WalkRes{
+		WalkDepth: WD_All,
+		WalkType:  WT_Zip,
+		WalkMode:  WM_All,
+		RootPath:  modPath + "@" + info.Version + strings.TrimPrefix(importPath, modPath),
+		Archive:   data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking package: %v", err)
+	} else if len(pdoc.Files) == 0 && len(pdoc.Dirs) == 0 {
+		return nil, ErrPackageNoGoFile
+	}
+	return pdoc, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+// newTestProxy serves a stand-in GOPROXY from a temporary directory.
+func newTestProxy(t *testing.T) (*httptest.Server, func()) {
+	dir, err := ioutil.TempDir("", "goproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"go.mod":     "module example.com/Hello\n",
+		"hello.go":   "// Package hello says hello.\npackage hello\n\n// Hello returns greeting.\nfunc Hello() string { return \"hello\" }\n",
+		"sub/sub.go": "// Package sub is a sub-package.\npackage sub\n\n// Sub does nothing.\nfunc Sub() {}\n",
+	} {
+		// Module path in archive is not escaped.
+		fw, err := zw.Create("example.com/Hello@v1.0.0/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"example.com/!hello/@v/list":        []byte("v0.9.0\nv1.0.0\nv1.1.0-rc.1\n"),
+		"example.com/!hello/@v/v1.0.0.info": []byte(`{"Version":"v1.0.0","Time":"2015-10-01T00:00:00Z"}`),
+		"example.com/!hello/@v/v1.0.0.zip":  buf.Bytes(),
+	}
+	for name, data := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+		if err = ioutil.WriteFile(fpath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	return ts, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetGoProxyDoc(t *testing.T) {
+	ts, cleanup := newTestProxy(t)
+	defer cleanup()
+
+	oldURL := setting.GoProxyURL
+	setting.GoProxyURL = ts.URL
+	defer func() { setting.GoProxyURL = oldURL }()
+
+	pdoc, err := getGoProxyDoc(context.Background(), map[string]string{"importPath": "example.com/Hello"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdoc.ProjectPath != "example.com/Hello" || pdoc.Etag != "v1.0.0" {
+		t.Fatalf("unexpected project path or etag: %s, %s", pdoc.ProjectPath, pdoc.Etag)
+	}
+	if len(pdoc.Funcs) != 1 || pdoc.Funcs[0].Name != "Hello" {
+		t.Fatalf("unexpected funcs: %v", pdoc.Funcs)
+	}
+	if pdoc.Subdirs != "sub" {
+		t.Fatalf("unexpected subdirs: %s", pdoc.Subdirs)
+	}
+
+	// Sub-package is resolved to its module.
+	pdoc, err = getGoProxyDoc(context.Background(), map[string]string{"importPath": "example.com/Hello/sub"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdoc.ProjectPath != "example.com/Hello" || pdoc.Synopsis != "Package sub is a sub-package." {
+		t.Fatalf("unexpected sub-package: %s, %s", pdoc.ProjectPath, pdoc.Synopsis)
+	}
+
+	if _, err = getGoProxyDoc(context.Background(), map[string]string{"importPath": "example.com/Hello"}, "v1.0.0"); err != ErrPackageNotModified {
+		t.Fatalf("expect ErrPackageNotModified but got: %v", err)
+	}
+
+	if _, err = getGoProxyDoc(context.Background(), map[string]string{"importPath": "example.com/nope"}, ""); err != ErrNoServiceMatch {
+		t.Fatalf("expect ErrNoServiceMatch but got: %v", err)
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	for _, c := range []struct {
+		versions []string
+		expect   string
+	}{
+		{[]string{"v1.0.0", "v1.10.0", "v1.2.0"}, "v1.10.0"},
+		{[]string{"v1.0.0", "v2.0.0-rc.1"}, "v1.0.0"},
+		{[]string{"v2.0.0-rc.1", "v2.0.0-beta"}, "v2.0.0-rc.1"},
+		{[]string{"v2.0.0+incompatible", "v1.9.0"}, "v2.0.0+incompatible"},
+		{nil, ""},
+	} {
+		if v := latestVersion(c.versions); v != c.expect {
+			t.Errorf("latestVersion(%v): expect %s but got %s", c.versions, c.expect, v)
+		}
+	}
+}
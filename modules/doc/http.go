@@ -15,6 +15,7 @@
 package doc
 
 import (
+	"context"
 	"flag"
 	"net"
 	"net/http"
@@ -50,3 +51,17 @@ var (
 	httpTransport = &transport{t: http.Transport{Dial: timeoutDial, ResponseHeaderTimeout: *requestTimeout / 2}}
 	Client        = &http.Client{Transport: httpTransport}
 )
+
+// contextTransport binds requests to a context so they are canceled with it.
+type contextTransport struct {
+	ctx context.Context
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return httpTransport.RoundTrip(req.WithContext(t.ctx))
+}
+
+// newClient returns a client whose requests are canceled when given context is done.
+func newClient(ctx context.Context) *http.Client {
+	return &http.Client{Transport: &contextTransport{ctx}}
+}
@@ -0,0 +1,187 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// MAX_DOC_TERMS limits number of terms from documentation text of a package.
+const MAX_DOC_TERMS = 300
+
+var (
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+	stopWords = map[string]bool{
+		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+		"be": true, "by": true, "for": true, "from": true, "if": true, "in": true,
+		"is": true, "it": true, "its": true, "of": true, "on": true, "or": true,
+		"package": true, "that": true, "the": true, "this": true, "to": true, "with": true,
+	}
+)
+
+// splitCamelCase splits identifier into words, e.g. "ParseHTTPRequest" -> "Parse", "HTTP", "Request".
+func splitCamelCase(name string) []string {
+	runes := []rune(name)
+	words := make([]string, 0, 3)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		// Break before an upper case letter that follows a lower case letter,
+		// or ends a sequence of upper case letters.
+		if !unicode.IsUpper(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+type termIndexer struct {
+	terms map[string]*models.PkgTerm
+}
+
+// add records a term, only the source with the highest weight is kept.
+func (ti *termIndexer) add(term, anchor string, weight int) {
+	if len(term) < 2 || stopWords[term] {
+		return
+	}
+	if t, ok := ti.terms[term]; ok && t.Weight >= weight {
+		return
+	}
+	ti.terms[term] = &models.PkgTerm{
+		Term:   term,
+		Anchor: anchor,
+		Weight: weight,
+	}
+}
+
+func (ti *termIndexer) addText(text string, weight int) {
+	for _, t := range models.SplitTerms(text) {
+		ti.add(t, "", weight)
+	}
+}
+
+func (ti *termIndexer) addIdent(name, anchor string) {
+	ti.add(strings.ToLower(name), anchor, models.TERM_WEIGHT_IDENT)
+	words := splitCamelCase(name)
+	if len(words) == 1 {
+		return
+	}
+	for _, w := range words {
+		ti.add(strings.ToLower(w), anchor, models.TERM_WEIGHT_SUB_IDENT)
+	}
+}
+
+// IndexTerms returns terms of inverted index for given package,
+// which come from import path, synopsis, documentation and exported identifiers.
+func IndexTerms(pdoc *Package) []*models.PkgTerm {
+	ti := &termIndexer{make(map[string]*models.PkgTerm)}
+
+	// Host name is skipped because it's shared by too many packages.
+	names := strings.Split(pdoc.ImportPath, "/")
+	if len(names) > 1 && strings.Contains(names[0], ".") {
+		names = names[1:]
+	}
+	for _, name := range names {
+		ti.addText(name, models.TERM_WEIGHT_PATH)
+	}
+	ti.add(strings.ToLower(path.Base(pdoc.ImportPath)), "", models.TERM_WEIGHT_EXACT_NAME)
+
+	ti.addText(pdoc.Synopsis, models.TERM_WEIGHT_SYNOPSIS)
+
+	if pdoc.PkgDecl != nil {
+		docText := stripHTML(pdoc.Doc)
+		for i, t := range models.SplitTerms(docText) {
+			if i >= MAX_DOC_TERMS {
+				break
+			}
+			ti.add(t, "", models.TERM_WEIGHT_DOC)
+		}
+
+		for _, f := range pdoc.Funcs {
+			ti.addIdent(f.Name, f.Name)
+		}
+		for _, t := range pdoc.Types {
+			ti.addIdent(t.Name, t.Name)
+			for _, f := range t.Funcs {
+				ti.addIdent(f.Name, f.Name)
+			}
+			for _, m := range t.Methods {
+				ti.addIdent(m.Name, t.Name+"_"+m.Name)
+			}
+		}
+	}
+
+	terms := make([]*models.PkgTerm, 0, len(ti.terms))
+	for _, t := range ti.terms {
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// stripHTML returns plain text of given HTML.
+func stripHTML(s string) string {
+	return html.UnescapeString(htmlTagPattern.ReplaceAllString(s, " "))
+}
+
+// exportDesc returns beginning of documentation in plain text,
+// whose length is limited to 100.
+func exportDesc(doc string) string {
+	doc = strings.Join(strings.Fields(stripHTML(doc)), " ")
+	if runes := []rune(doc); len(runes) > 100 {
+		return string(runes[:100]) + "..."
+	}
+	return doc
+}
+
+// IndexExports returns exported functions, types and methods of given package.
+func IndexExports(pdoc *Package) []*models.PkgExport {
+	if pdoc.PkgDecl == nil {
+		return nil
+	}
+
+	exports := make([]*models.PkgExport, 0, len(pdoc.Funcs)+len(pdoc.Types))
+	addExport := func(name, anchor, doc string) {
+		exports = append(exports, &models.PkgExport{
+			Name:   strings.ToLower(name),
+			Anchor: anchor,
+			Desc:   exportDesc(doc),
+		})
+	}
+
+	for _, f := range pdoc.Funcs {
+		addExport(f.Name, f.Name, f.Doc)
+	}
+	for _, t := range pdoc.Types {
+		addExport(t.Name, t.Name, t.Doc)
+		for _, f := range t.Funcs {
+			addExport(f.Name, f.Name, f.Doc)
+		}
+		for _, m := range t.Methods {
+			addExport(m.Name, t.Name+"_"+m.Name, m.Doc)
+		}
+	}
+	return exports
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+func TestIndexExportsDesc(t *testing.T) {
+	long := strings.Repeat("<code>word</code> ", 40)
+	pdoc := &Package{PkgDecl: &PkgDecl{File: File{Funcs: []*Func{
+		{Name: "Plain", Doc: "Plain returns a & b.\n"},
+		{Name: "Rendered", Doc: "<p>\nRendered returns a &amp; b.\n</p>\n"},
+		{Name: "Long", Doc: "<p>\n" + long + "</p>\n"},
+	}}}}
+
+	exports := IndexExports(pdoc)
+	if len(exports) != 3 {
+		t.Fatalf("expect 3 exports but got %d", len(exports))
+	}
+	for i, expect := range []string{
+		"Plain returns a & b.",
+		"Rendered returns a & b.",
+		strings.Repeat("word ", 20) + "...",
+	} {
+		if exports[i].Desc != expect {
+			t.Errorf("%s: expect %q but got %q", exports[i].Name, expect, exports[i].Desc)
+		}
+		if strings.ContainsAny(exports[i].Desc, "<>") {
+			t.Errorf("%s: description contains markup: %q", exports[i].Name, exports[i].Desc)
+		}
+	}
+}
+
+func TestSplitCamelCase(t *testing.T) {
+	for name, expect := range map[string][]string{
+		"Hello":            {"Hello"},
+		"hello":            {"hello"},
+		"ID":               {"ID"},
+		"UserID":           {"User", "ID"},
+		"HTTPServer":       {"HTTP", "Server"},
+		"ParseHTTPRequest": {"Parse", "HTTP", "Request"},
+		"Int64":            {"Int64"},
+		"SHA256Sum":        {"SHA256", "Sum"},
+		"Go2HTML":          {"Go2", "HTML"},
+	} {
+		if words := splitCamelCase(name); !reflect.DeepEqual(words, expect) {
+			t.Errorf("%s: expect %v but got %v", name, expect, words)
+		}
+	}
+}
+
+func TestIndexTerms(t *testing.T) {
+	pdoc := &Package{
+		PkgInfo: &models.PkgInfo{
+			ImportPath: "github.com/user/webserver",
+			Synopsis:   "Package webserver serves the web.",
+		},
+		PkgDecl: &PkgDecl{
+			Doc: "<p><b>Package webserver serves the web.</b></p>\n<pre>a &lt; b &amp;&amp; handles</pre>\n",
+			File: File{
+				Funcs: []*Func{{Name: "HTTPServer"}},
+				Types: []*Type{{
+					Name:    "Kind",
+					Methods: []*Func{{Name: "String"}},
+				}},
+			},
+		},
+	}
+
+	terms := make(map[string]*models.PkgTerm)
+	for _, term := range IndexTerms(pdoc) {
+		terms[term.Term] = term
+	}
+	for term, expect := range map[string]struct {
+		anchor string
+		weight int
+	}{
+		"user":       {"", models.TERM_WEIGHT_PATH},
+		"webserver":  {"", models.TERM_WEIGHT_EXACT_NAME},
+		"serves":     {"", models.TERM_WEIGHT_SYNOPSIS},
+		"handles":    {"", models.TERM_WEIGHT_DOC},
+		"httpserver": {"HTTPServer", models.TERM_WEIGHT_IDENT},
+		"http":       {"HTTPServer", models.TERM_WEIGHT_SUB_IDENT},
+		"server":     {"HTTPServer", models.TERM_WEIGHT_SUB_IDENT},
+		"kind":       {"Kind", models.TERM_WEIGHT_IDENT},
+		"string":     {"Kind_String", models.TERM_WEIGHT_IDENT},
+	} {
+		if tm := terms[term]; tm == nil {
+			t.Errorf("%s: term not found", term)
+		} else if tm.Anchor != expect.anchor || tm.Weight != expect.weight {
+			t.Errorf("%s: expect anchor %q and weight %d but got %q and %d",
+				term, expect.anchor, expect.weight, tm.Anchor, tm.Weight)
+		}
+	}
+
+	// Host name, stop words, HTML tags and entities are not terms.
+	for _, term := range []string{"github", "com", "the", "pre", "amp", "lt"} {
+		if terms[term] != nil {
+			t.Errorf("%s: unexpected term", term)
+		}
+	}
+}
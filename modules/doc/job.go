@@ -0,0 +1,188 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// JobState represents the stage of a documentation generation job.
+type JobState string
+
+const (
+	JOB_FETCHING    JobState = "fetching"    // Fetching metadata of repository.
+	JOB_DOWNLOADING JobState = "downloading" // Downloading source files.
+	JOB_WALKING     JobState = "walking"     // Parsing source files.
+	JOB_RENDERING   JobState = "rendering"
+	JOB_SAVING      JobState = "saving"
+	JOB_DONE        JobState = "done"
+	JOB_FAILED      JobState = "failed"
+)
+
+// JOB_KEEP is how long a finished job is kept for its status to be queried.
+const JOB_KEEP = 10 * time.Minute
+
+// JobStatus is a snapshot of a job.
+type JobStatus struct {
+	ID         string   `json:"id"`
+	ImportPath string   `json:"import_path"`
+	Version    string   `json:"version,omitempty"`
+	State      JobState `json:"state"`
+	NumFiles   int      `json:"num_files,omitempty"` // Number of files being downloaded, zero if unknown.
+	Error      string   `json:"error,omitempty"`
+	Created    int64    `json:"created"`
+	Updated    int64    `json:"updated"`
+}
+
+func (s JobStatus) docPath() string {
+	return DocPath(s.ImportPath, s.Version)
+}
+
+// Job represents a documentation generation of a version of package.
+type Job struct {
+	lock   sync.RWMutex
+	status JobStatus
+}
+
+// Status returns current status of the job.
+func (j *Job) Status() JobStatus {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.status
+}
+
+func (j *Job) isFinished() bool {
+	state := j.Status().State
+	return state == JOB_DONE || state == JOB_FAILED
+}
+
+func (j *Job) setState(state JobState, numFiles int) {
+	j.lock.Lock()
+	j.status.State = state
+	j.status.NumFiles = numFiles
+	j.status.Updated = time.Now().UTC().Unix()
+	j.lock.Unlock()
+}
+
+func (j *Job) finish(err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.status.State = JOB_DONE
+	if err != nil {
+		j.status.State = JOB_FAILED
+		j.status.Error = err.Error()
+	}
+	j.status.NumFiles = 0
+	j.status.Updated = time.Now().UTC().Unix()
+}
+
+// jobSet keeps in-flight and recently finished jobs.
+type jobSet struct {
+	lock   sync.RWMutex
+	jobs   map[string]*Job
+	byPath map[string]*Job // Latest job of every doc path.
+}
+
+var jobs = &jobSet{
+	jobs:   make(map[string]*Job),
+	byPath: make(map[string]*Job),
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// add creates and returns a new job, jobs finished longer than JOB_KEEP are removed.
+func (s *jobSet) add(importPath, version string) *Job {
+	now := time.Now().UTC().Unix()
+	j := &Job{
+		status: JobStatus{
+			ID:         newJobID(),
+			ImportPath: importPath,
+			Version:    version,
+			State:      JOB_FETCHING,
+			Created:    now,
+			Updated:    now,
+		},
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, job := range s.jobs {
+		status := job.Status()
+		if job.isFinished() && now-status.Updated > int64(JOB_KEEP/time.Second) {
+			delete(s.jobs, id)
+			if s.byPath[status.docPath()] == job {
+				delete(s.byPath, status.docPath())
+			}
+		}
+	}
+	s.jobs[j.status.ID] = j
+	s.byPath[j.status.docPath()] = j
+	return j
+}
+
+// GetJob returns job by given ID, it returns nil if not found.
+func GetJob(id string) *Job {
+	jobs.lock.RLock()
+	defer jobs.lock.RUnlock()
+	return jobs.jobs[id]
+}
+
+// GetJobByPath returns latest job of given doc path in form of "<import path>@<version>",
+// it returns nil if not found.
+func GetJobByPath(docPath string) *Job {
+	jobs.lock.RLock()
+	defer jobs.lock.RUnlock()
+	return jobs.byPath[docPath]
+}
+
+// GetUnfinishedJob returns the first unfinished job of given doc paths,
+// it returns nil if not found.
+func GetUnfinishedJob(docPaths ...string) *Job {
+	for _, p := range docPaths {
+		if job := GetJobByPath(p); job != nil && !job.isFinished() {
+			return job
+		}
+	}
+	return nil
+}
+
+type jobKey struct{}
+
+// withJob returns a context that carries given job for progress reporting.
+func withJob(ctx context.Context, j *Job) context.Context {
+	return context.WithValue(ctx, jobKey{}, j)
+}
+
+// setJobState reports stage of the job carried by given context if any.
+func setJobState(ctx context.Context, state JobState) {
+	setJobFiles(ctx, state, 0)
+}
+
+// setJobFiles reports stage of the job carried by given context if any,
+// along with number of files are involved.
+func setJobFiles(ctx context.Context, state JobState, numFiles int) {
+	if j, ok := ctx.Value(jobKey{}).(*Job); ok {
+		j.setState(state, numFiles)
+	}
+}
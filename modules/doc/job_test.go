@@ -0,0 +1,162 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestJobSet replaces global job set by an empty one,
+// returned function restores the original one.
+func newTestJobSet() func() {
+	old := jobs
+	jobs = &jobSet{
+		jobs:   make(map[string]*Job),
+		byPath: make(map[string]*Job),
+	}
+	return func() {
+		jobs = old
+	}
+}
+
+func TestJobState(t *testing.T) {
+	defer newTestJobSet()()
+
+	j := jobs.add("github.com/user/pkg", "v1.0.0")
+	if status := j.Status(); status.State != JOB_FETCHING || status.ID == "" || j.isFinished() {
+		t.Fatalf("unexpected status of new job: %+v", status)
+	}
+
+	ctx := withJob(context.Background(), j)
+	for _, tc := range []struct {
+		state    JobState
+		numFiles int
+	}{
+		{JOB_DOWNLOADING, 12},
+		{JOB_WALKING, 0},
+		{JOB_RENDERING, 0},
+		{JOB_SAVING, 0},
+	} {
+		setJobFiles(ctx, tc.state, tc.numFiles)
+		if status := j.Status(); status.State != tc.state || status.NumFiles != tc.numFiles {
+			t.Errorf("%s: unexpected status %+v", tc.state, status)
+		}
+		if j.isFinished() {
+			t.Errorf("%s: job is finished", tc.state)
+		}
+	}
+
+	// Number of files is reset by stages without it.
+	setJobFiles(ctx, JOB_DOWNLOADING, 3)
+	setJobState(ctx, JOB_WALKING)
+	if status := j.Status(); status.NumFiles != 0 {
+		t.Errorf("expect no files but got %d", status.NumFiles)
+	}
+
+	// Context without job is ignored.
+	setJobState(context.Background(), JOB_FAILED)
+	if j.isFinished() {
+		t.Error("job is changed by unrelated context")
+	}
+
+	j.finish(nil)
+	if status := j.Status(); status.State != JOB_DONE || status.Error != "" || !j.isFinished() {
+		t.Errorf("unexpected status of finished job: %+v", status)
+	}
+
+	j = jobs.add("github.com/user/pkg", "")
+	setJobFiles(withJob(context.Background(), j), JOB_DOWNLOADING, 5)
+	j.finish(errors.New("not found"))
+	if status := j.Status(); status.State != JOB_FAILED || status.Error != "not found" || status.NumFiles != 0 {
+		t.Errorf("unexpected status of failed job: %+v", status)
+	}
+}
+
+func TestGetJobByPath(t *testing.T) {
+	defer newTestJobSet()()
+
+	first := jobs.add("github.com/user/pkg", "")
+	versioned := jobs.add("github.com/user/pkg", "v1.0.0")
+	first.finish(nil)
+	latest := jobs.add("github.com/user/pkg", "")
+
+	if GetJob(first.Status().ID) != first {
+		t.Error("finished job is not found by ID")
+	}
+	if GetJob("unknown") != nil {
+		t.Error("unknown job is found")
+	}
+	for docPath, expect := range map[string]*Job{
+		"github.com/user/pkg":        latest,
+		"github.com/user/pkg@v1.0.0": versioned,
+		"github.com/user/pkg@v2.0.0": nil,
+		"github.com/user/other":      nil,
+	} {
+		if j := GetJobByPath(docPath); j != expect {
+			t.Errorf("%s: unexpected job %v", docPath, j)
+		}
+	}
+
+	latest.finish(nil)
+	if j := GetUnfinishedJob(DocPath("github.com/user/pkg", ""), DocPath("github.com/user/pkg", "v1.0.0")); j != versioned {
+		t.Errorf("expect unfinished job of v1.0.0 but got %v", j)
+	}
+	versioned.finish(errors.New("canceled"))
+	if j := GetUnfinishedJob(DocPath("github.com/user/pkg", ""), DocPath("github.com/user/pkg", "v1.0.0")); j != nil {
+		t.Errorf("expect no unfinished job but got %v", j)
+	}
+}
+
+func TestJobSetExpiry(t *testing.T) {
+	defer newTestJobSet()()
+
+	expired := jobs.add("github.com/user/expired", "")
+	expired.finish(nil)
+	replaced := jobs.add("github.com/user/replaced", "")
+	replaced.finish(nil)
+	latest := jobs.add("github.com/user/replaced", "")
+	recent := jobs.add("github.com/user/recent", "")
+	recent.finish(nil)
+	running := jobs.add("github.com/user/running", "")
+
+	old := time.Now().UTC().Add(-JOB_KEEP - time.Minute).Unix()
+	for _, j := range []*Job{expired, replaced, running} {
+		j.status.Updated = old
+	}
+
+	// Expired jobs are removed when a new job is added.
+	jobs.add("github.com/user/new", "")
+
+	for j, expect := range map[*Job]bool{
+		expired:  false,
+		replaced: false,
+		latest:   true,
+		recent:   true,
+		running:  true, // Unfinished jobs never expire.
+	} {
+		if found := GetJob(j.Status().ID) == j; found != expect {
+			t.Errorf("%s: expect found %v but got %v", j.Status().ImportPath, expect, found)
+		}
+	}
+	if GetJobByPath("github.com/user/expired") != nil {
+		t.Error("expired job is still found by path")
+	}
+	if GetJobByPath("github.com/user/replaced") != latest {
+		t.Error("latest job is removed along with the expired one of same path")
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/Unknwon/com"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/base"
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+var (
+	ErrNoLocalMatch = errors.New("Package does not exist in any local root")
+)
+
+// escapeModulePath returns module path in form of module cache,
+// which replaces every upper case letter with an exclamation mark
+// followed by the letter's lower case.
+func escapeModulePath(modPath string) string {
+	var buf []rune
+	for _, r := range modPath {
+		if unicode.IsUpper(r) {
+			buf = append(buf, '!', unicode.ToLower(r))
+			continue
+		}
+		buf = append(buf, r)
+	}
+	return string(buf)
+}
+
+// parseVersion returns numeric parts and pre-release of a semantic version.
+func parseVersion(ver string) (nums [3]int, pre string) {
+	ver = strings.TrimPrefix(ver, "v")
+	// Build metadata does not affect precedence.
+	if i := strings.Index(ver, "+"); i > -1 {
+		ver = ver[:i]
+	}
+	if i := strings.Index(ver, "-"); i > -1 {
+		pre = ver[i+1:]
+		ver = ver[:i]
+	}
+	for i, s := range strings.SplitN(ver, ".", 3) {
+		nums[i] = com.StrTo(s).MustInt()
+	}
+	return nums, pre
+}
+
+// compareVersion returns an integer comparing two semantic versions.
+// The result will be 0 if a==b, -1 if a < b, and +1 if a > b.
+func compareVersion(a, b string) int {
+	an, apre := parseVersion(a)
+	bn, bpre := parseVersion(b)
+	for i := range an {
+		switch {
+		case an[i] < bn[i]:
+			return -1
+		case an[i] > bn[i]:
+			return 1
+		}
+	}
+
+	// Release version is always greater than pre-release version.
+	switch {
+	case apre == bpre:
+		return 0
+	case len(apre) == 0:
+		return 1
+	case len(bpre) == 0:
+		return -1
+	}
+	return comparePrerelease(apre, bpre)
+}
+
+// isNumericIdent returns true if given pre-release identifier only has digits.
+func isNumericIdent(id string) bool {
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(id) > 0
+}
+
+// comparePrerelease compares dot-separated identifiers of two pre-releases one by one,
+// numeric identifiers are compared numerically and lower than alphanumeric ones.
+// Pre-release with more identifiers is greater if all preceding ones are equal.
+func comparePrerelease(a, b string) int {
+	aids, bids := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aids) && i < len(bids); i++ {
+		x, y := aids[i], bids[i]
+		if x == y {
+			continue
+		}
+
+		xnum, ynum := isNumericIdent(x), isNumericIdent(y)
+		switch {
+		case xnum && ynum:
+			// Compare by length first so numbers of any size are ordered.
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				if len(x) < len(y) {
+					return -1
+				}
+				return 1
+			}
+		case xnum:
+			return -1
+		case ynum:
+			return 1
+		}
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	}
+
+	switch {
+	case len(aids) < len(bids):
+		return -1
+	case len(aids) > len(bids):
+		return 1
+	}
+	return 0
+}
+
+// isValidLocalPath returns true if given import path is relative and
+// has no empty, "." or ".." element, so it cannot escape from any root.
+func isValidLocalPath(importPath string) bool {
+	if len(importPath) == 0 || strings.ContainsRune(importPath, '\\') ||
+		filepath.IsAbs(filepath.FromSlash(importPath)) {
+		return false
+	}
+	for _, elem := range strings.Split(importPath, "/") {
+		if len(elem) == 0 || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// isInRoot returns true if given directory is inside the root.
+func isInRoot(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// findModDir returns the directory of given or latest module version in module cache
+// that contains given import path, and its module path.
+func findModDir(root, importPath, version string) (string, string) {
+	for modPath := importPath; modPath != "." && modPath != "/"; modPath = path.Dir(modPath) {
+		escaped := escapeModulePath(modPath)
+		fis, err := ioutil.ReadDir(filepath.Join(root, filepath.FromSlash(path.Dir(escaped))))
+		if err != nil {
+			continue
+		}
+
+		prefix := path.Base(escaped) + "@"
+		var latest string
+		for _, fi := range fis {
+			if !fi.IsDir() || !strings.HasPrefix(fi.Name(), prefix) {
+				continue
+			}
+			ver := fi.Name()[len(prefix):]
+			if len(version) > 0 {
+				if ver == escapeModulePath(version) {
+					latest = ver
+					break
+				}
+				continue
+			}
+			if len(latest) == 0 || compareVersion(ver, latest) > 0 {
+				latest = ver
+			}
+		}
+		if len(latest) == 0 {
+			continue
+		}
+
+		dir := filepath.Join(root, filepath.FromSlash(path.Dir(escaped)), prefix+latest,
+			filepath.FromSlash(strings.TrimPrefix(importPath, modPath)))
+		if isInRoot(root, dir) && com.IsDir(dir) {
+			return dir, modPath
+		}
+	}
+	return "", ""
+}
+
+// readModulePath returns the module path declared in given go.mod file.
+func readModulePath(fpath string) string {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// findSrcDir returns the directory of given import path in source roots,
+// and the closest module path or the import path itself if no go.mod file is found.
+func findSrcDir(root, importPath string) (string, string) {
+	dir := filepath.Join(root, filepath.FromSlash(importPath))
+	if !isInRoot(root, dir) || !com.IsDir(dir) {
+		return "", ""
+	}
+
+	for p := importPath; p != "." && p != "/"; p = path.Dir(p) {
+		if modPath := readModulePath(filepath.Join(root, filepath.FromSlash(p), "go.mod")); len(modPath) > 0 {
+			return dir, modPath
+		}
+	}
+	return dir, importPath
+}
+
+// localEtag returns etag of directory based on the latest modified time of its files.
+func localEtag(dir string) (string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var latest int64
+	for _, fi := range fis {
+		if fi.IsDir() || !base.IsDocFile(fi.Name()) {
+			continue
+		}
+		if t := fi.ModTime().UnixNano(); t > latest {
+			latest = t
+		}
+	}
+	return fmt.Sprintf("local-%d-%d", len(fis), latest), nil
+}
+
+// getLocalDoc generates documentation of given import path from local roots.
+// Source roots are only used when no module version is given.
+// It returns ErrNoLocalMatch if the import path is not found in any root.
+func getLocalDoc(importPath, version, etag string) (*Package, error) {
+	if !isValidLocalPath(importPath) {
+		return nil, ErrInvalidRemotePath
+	}
+
+	var dir, projectPath string
+	if len(version) == 0 {
+		for _, root := range setting.LocalSrcRoots {
+			if dir, projectPath = findSrcDir(root, importPath); len(dir) > 0 {
+				break
+			}
+		}
+	}
+	if len(dir) == 0 {
+		for _, root := range setting.LocalModRoots {
+			if dir, projectPath = findModDir(root, importPath, version); len(dir) > 0 {
+				break
+			}
+		}
+	}
+	if len(dir) == 0 {
+		return nil, ErrNoLocalMatch
+	}
+
+	commit, err := localEtag(dir)
+	if err != nil {
+		return nil, fmt.Errorf("get etag: %v", err)
+	} else if commit == etag {
+		return nil, ErrPackageNotModified
+	}
+
+	w := &Walker{
+		LineFmt: "#L%d",
+		Pdoc: &Package{
+			PkgInfo: &models.PkgInfo{
+				ImportPath:  importPath,
+				ProjectPath: projectPath,
+				IsGoRepo:    base.IsGoRepoPath(importPath),
+				Etag:        commit,
+			},
+		},
+	}
+
+	var browseUrlTpl string
+	if len(setting.LocalBrowseURL) > 0 {
+		browseUrlTpl = com.Expand(setting.LocalBrowseURL, map[string]string{
+			"importPath": importPath,
+			"0":          "{0}",
+		})
+	}
+
+	pdoc, err := w.Build(&WalkRes{
+		WalkDepth:    WD_All,
+		WalkType:     WT_Local,
+		WalkMode:     WM_All,
+		RootPath:     dir,
+		BrowseUrlTpl: browseUrlTpl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk package: %v", err)
+	} else if len(pdoc.Files) == 0 && len(pdoc.Dirs) == 0 {
+		return nil, ErrPackageNoGoFile
+	}
+	return pdoc, nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+func TestIsValidLocalPath(t *testing.T) {
+	for importPath, expect := range map[string]bool{
+		"example.com/hello":     true,
+		"example.com/hello/sub": true,
+		"":                      false,
+		"/etc/passwd":           false,
+		"../etc":                false,
+		"example.com/../../etc": false,
+		"example.com/./hello":   false,
+		"example.com//hello":    false,
+		"example.com/hello/":    false,
+		`example.com\..\etc`:    false,
+	} {
+		if isValidLocalPath(importPath) != expect {
+			t.Errorf("isValidLocalPath(%q): expect %v", importPath, expect)
+		}
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	// Every version is less than the ones after it.
+	versions := []string{
+		"v0.9.0",
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0-rc.2",
+		"v1.0.0-rc.10",
+		"v1.0.0",
+		"v1.2.0",
+		"v1.10.0",
+	}
+	for i, a := range versions {
+		for j, b := range versions {
+			expect := 0
+			if i < j {
+				expect = -1
+			} else if i > j {
+				expect = 1
+			}
+			if r := compareVersion(a, b); r != expect {
+				t.Errorf("compareVersion(%s, %s): expect %d but got %d", a, b, expect, r)
+			}
+		}
+	}
+
+	// Build metadata and leading zeros do not affect precedence.
+	for _, c := range [][2]string{
+		{"v1.0.0+build", "v1.0.0"},
+		{"v1.0.0-rc.01", "v1.0.0-rc.1"},
+	} {
+		if r := compareVersion(c[0], c[1]); r != 0 {
+			t.Errorf("compareVersion(%s, %s): expect 0 but got %d", c[0], c[1], r)
+		}
+	}
+}
+
+func TestReadModulePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for content, expect := range map[string]string{
+		"module example.com/hello\n":                 "example.com/hello",
+		"// comment\nmodule \"example.com/hello\"\n": "example.com/hello",
+		"modulefoo example.com/hello\n":              "",
+		"go 1.12\n\nmodule example.com/hello // x\n": "example.com/hello",
+	} {
+		fpath := filepath.Join(dir, "go.mod")
+		if err = ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if modPath := readModulePath(fpath); modPath != expect {
+			t.Errorf("readModulePath(%q): expect %q but got %q", content, expect, modPath)
+		}
+	}
+}
+
+func TestGetLocalDocOutOfRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Package outside of the root must not be reachable by relative path.
+	root := filepath.Join(dir, "src")
+	secret := filepath.Join(dir, "secret")
+	for _, d := range []string{filepath.Join(root, "example.com/hello"), secret} {
+		os.MkdirAll(d, os.ModePerm)
+		if err = ioutil.WriteFile(filepath.Join(d, "a.go"), []byte("package a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldRoots := setting.LocalSrcRoots
+	setting.LocalSrcRoots = []string{root}
+	defer func() { setting.LocalSrcRoots = oldRoots }()
+
+	if _, err = getLocalDoc("../secret", "", ""); err != ErrInvalidRemotePath {
+		t.Fatalf("expect ErrInvalidRemotePath but got: %v", err)
+	}
+	if d, _ := findSrcDir(root, "../secret"); len(d) > 0 {
+		t.Fatalf("directory out of root is found: %s", d)
+	}
+	if d, _ := findSrcDir(root, "example.com/hello"); d != filepath.Join(root, "example.com/hello") {
+		t.Fatalf("expect directory in root but got: %q", d)
+	}
+}
+
+func TestGetLocalDoc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcRoot := filepath.Join(dir, "src")
+	modRoot := filepath.Join(dir, "pkg", "mod")
+	for name, content := range map[string]string{
+		"src/example.com/hello/go.mod":                     "module example.com/hello\n",
+		"src/example.com/hello/hello.go":                   "// Package hello says hello.\npackage hello\n\nfunc Hello() {}\n",
+		"src/example.com/hello/sub/sub.go":                 "package sub\n",
+		"pkg/mod/example.com/!foo@v1.2.3/go.mod":           "module example.com/Foo\n",
+		"pkg/mod/example.com/!foo@v1.2.3/bar/bar.go":       "package bar\n\nfunc V123() {}\n",
+		"pkg/mod/example.com/!foo@v1.10.0/go.mod":          "module example.com/Foo\n",
+		"pkg/mod/example.com/!foo@v1.10.0/bar/bar.go":      "package bar\n\nfunc V1100() {}\n",
+		"pkg/mod/example.com/!foo@v1.10.0-rc.1/bar/bar.go": "package bar\n\nfunc V1100RC1() {}\n",
+	} {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+		if err = ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldSrcRoots, oldModRoots := setting.LocalSrcRoots, setting.LocalModRoots
+	setting.LocalSrcRoots, setting.LocalModRoots = []string{srcRoot}, []string{modRoot}
+	defer func() { setting.LocalSrcRoots, setting.LocalModRoots = oldSrcRoots, oldModRoots }()
+
+	for _, c := range []struct {
+		importPath, version string
+		dir, projectPath    string
+		funcName            string
+	}{
+		{"example.com/hello", "", "src/example.com/hello", "example.com/hello", "Hello"},
+		{"example.com/Foo/bar", "v1.2.3", "pkg/mod/example.com/!foo@v1.2.3/bar", "example.com/Foo", "V123"},
+		// Latest version is used without version, v1.10.0 is greater than
+		// v1.2.3 and its own pre-release.
+		{"example.com/Foo/bar", "", "pkg/mod/example.com/!foo@v1.10.0/bar", "example.com/Foo", "V1100"},
+	} {
+		pkgDir := filepath.Join(dir, filepath.FromSlash(c.dir))
+		etag, err := localEtag(pkgDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pdoc, err := getLocalDoc(c.importPath, c.version, "")
+		if err != nil {
+			t.Fatalf("%s@%s: %v", c.importPath, c.version, err)
+		}
+		if pdoc.ImportPath != c.importPath || pdoc.ProjectPath != c.projectPath || pdoc.Etag != etag {
+			t.Errorf("%s@%s: unexpected import path, project path or etag: %s, %s, %s",
+				c.importPath, c.version, pdoc.ImportPath, pdoc.ProjectPath, pdoc.Etag)
+		}
+		if len(pdoc.Funcs) != 1 || pdoc.Funcs[0].Name != c.funcName {
+			t.Errorf("%s@%s: expect func %s but got %v", c.importPath, c.version, c.funcName, pdoc.Funcs)
+		}
+
+		if _, err = getLocalDoc(c.importPath, c.version, etag); err != ErrPackageNotModified {
+			t.Errorf("%s@%s: expect ErrPackageNotModified but got: %v", c.importPath, c.version, err)
+		}
+	}
+
+	if _, err = getLocalDoc("example.com/Foo/bar", "v9.9.9", ""); err != ErrNoLocalMatch {
+		t.Fatalf("expect ErrNoLocalMatch but got: %v", err)
+	}
+}
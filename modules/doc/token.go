@@ -0,0 +1,368 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unknwon/com"
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+// Requests to GitHub are authenticated by tokens in a pool, either personal
+// access tokens or installation token of a GitHub App. Rate limit of each
+// token is tracked by response headers, and the next token is used once
+// the current one is exhausted.
+
+// githubApp exchanges JWT signed by private key of GitHub App for
+// installation token, which expires in an hour.
+type githubApp struct {
+	id             string
+	installationID string
+	key            *rsa.PrivateKey
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newGithubApp returns GitHub App with private key in PEM format.
+func newGithubApp(id, installationID string, pemData []byte) (*githubApp, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	app := &githubApp{
+		id:             id,
+		installationID: installationID,
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		k, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return nil, fmt.Errorf("parse private key: %v", err)
+		}
+		var ok bool
+		if key, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("private key is not RSA")
+		}
+	}
+	app.key = key
+	return app, nil
+}
+
+// jwt returns JSON Web Token to authenticate as the GitHub App.
+func (app *githubApp) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	claims, err := json.Marshal(map[string]interface{}{
+		// Allow clock drift as recommended by GitHub.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": app.id,
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, app.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + enc.EncodeToString(sig), nil
+}
+
+// installationToken returns cached installation token or requests a new one
+// if it's about to expire.
+func (app *githubApp) installationToken(ctx context.Context) (string, error) {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	if time.Now().Add(5 * time.Minute).Before(app.expires) {
+		return app.token, nil
+	}
+
+	jwt, err := app.jwt(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("sign JWT: %v", err)
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/app/installations/%s/access_tokens", githubAPIURL, app.installationID), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", com.UserAgent)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := newClient(ctx).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("create installation token: status %d: %s", resp.StatusCode, data)
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode installation token: %v", err)
+	}
+	app.token = result.Token
+	app.expires = result.ExpiresAt
+	return app.token, nil
+}
+
+// githubToken is a credential in the pool, empty value means anonymous.
+type githubToken struct {
+	value string
+	app   *githubApp
+
+	limit     int // Zero means unknown.
+	remaining int // Negative means unknown.
+	reset     time.Time
+}
+
+// available returns true if the token is not exhausted at given time.
+func (t *githubToken) available(now time.Time) bool {
+	return t.remaining != 0 || now.After(t.reset)
+}
+
+type tokenPool struct {
+	lock   sync.Mutex
+	tokens []*githubToken
+	cur    int
+}
+
+// newTokenPool returns pool of GitHub App and tokens in configuration,
+// pool of an anonymous token is returned if none is configured.
+func newTokenPool() *tokenPool {
+	p := &tokenPool{}
+	if len(setting.GitHubAppID) > 0 {
+		pemData, err := ioutil.ReadFile(setting.GitHubAppPrivateKey)
+		if err != nil {
+			log.Fatal("Fail to read private key of GitHub App: %v", err)
+		}
+		app, err := newGithubApp(setting.GitHubAppID, setting.GitHubAppInstallationID, pemData)
+		if err != nil {
+			log.Fatal("Fail to load private key of GitHub App: %v", err)
+		}
+		p.tokens = append(p.tokens, &githubToken{app: app, remaining: -1})
+	}
+	for _, v := range setting.GitHubTokens {
+		p.tokens = append(p.tokens, &githubToken{value: v, remaining: -1})
+	}
+	if len(p.tokens) == 0 {
+		p.tokens = append(p.tokens, &githubToken{remaining: -1})
+	}
+	return p
+}
+
+var githubTokens = newTokenPool()
+
+// pick returns the current token, or rotates to the next available one
+// if it's exhausted.
+func (p *tokenPool) pick() (*githubToken, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	for i := range p.tokens {
+		idx := (p.cur + i) % len(p.tokens)
+		if p.tokens[idx].available(now) {
+			p.cur = idx
+			return p.tokens[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("GitHub API rate limit exceeded until %s", p.resetTime().Format(time.RFC3339))
+}
+
+// resetTime returns the earliest time of tokens to be reset.
+func (p *tokenPool) resetTime() time.Time {
+	var reset time.Time
+	for _, t := range p.tokens {
+		if reset.IsZero() || t.reset.Before(reset) {
+			reset = t.reset
+		}
+	}
+	return reset
+}
+
+// update records rate limit of token from response headers, it returns true
+// if the request is rejected because the token is exhausted.
+func (p *tokenPool) update(t *githubToken, resp *http.Response) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if n, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		t.limit = n
+	}
+	if n, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		t.remaining = n
+	}
+	if sec, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		t.reset = time.Unix(sec, 0)
+	}
+
+	if resp.StatusCode != 403 && resp.StatusCode != 429 {
+		return false
+	}
+	// Secondary rate limit tells how long to wait.
+	if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		t.remaining = 0
+		t.reset = time.Now().Add(time.Duration(sec) * time.Second)
+	}
+	if t.remaining == 0 {
+		log.Warn("GitHub token #%d is exhausted until %s", p.indexOf(t), t.reset.Format(time.RFC3339))
+		return true
+	}
+	return false
+}
+
+func (p *tokenPool) indexOf(t *githubToken) int {
+	for i := range p.tokens {
+		if p.tokens[i] == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// GitHubRateLimitReset returns the earliest time of GitHub tokens to be reset
+// if all of them have no more than given number of requests remaining,
+// otherwise it returns zero time. The reserve is at most half of the limit
+// of a token, so a token with small limit such as anonymous one is still
+// shared with users.
+func GitHubRateLimitReset(reserve int) time.Time {
+	p := githubTokens
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	for _, t := range p.tokens {
+		r := reserve
+		if t.limit > 0 && r > t.limit/2 {
+			r = t.limit / 2
+		}
+		if t.remaining < 0 || t.remaining > r || now.After(t.reset) {
+			return time.Time{}
+		}
+	}
+	return p.resetTime()
+}
+
+// isGithubHost returns true if credentials should be sent to the host.
+func isGithubHost(host string) bool {
+	if u, err := url.Parse(githubAPIURL); err == nil && host == u.Host {
+		return true
+	}
+	return host == "github.com" || strings.HasSuffix(host, ".github.com") ||
+		host == "raw.githubusercontent.com"
+}
+
+// githubTransport authenticates requests to GitHub with tokens in the pool,
+// and retries with another token when the current one is exhausted.
+// Requests are canceled when the context is done.
+type githubTransport struct {
+	ctx context.Context
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isGithubHost(req.URL.Host) {
+		return httpTransport.RoundTrip(req.WithContext(t.ctx))
+	}
+
+	// Request body cannot be sent twice without GetBody, read it first.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	for {
+		token, err := githubTokens.pick()
+		if err != nil {
+			return nil, err
+		}
+		value := token.value
+		if token.app != nil {
+			if value, err = token.app.installationToken(t.ctx); err != nil {
+				return nil, fmt.Errorf("get installation token: %v", err)
+			}
+		}
+
+		// Request must not be modified by RoundTrip.
+		r := req.WithContext(t.ctx)
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, vs := range req.Header {
+			r.Header[k] = vs
+		}
+		if len(value) > 0 {
+			r.Header.Set("Authorization", "Bearer "+value)
+		}
+		if req.Body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := httpTransport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if !githubTokens.update(token, resp) {
+			return resp, nil
+		}
+
+		// Give up if no other token is available.
+		if next, err := githubTokens.pick(); err != nil || next == token {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// newGithubClient returns a client authenticated to GitHub whose requests
+// are canceled when given context is done.
+func newGithubClient(ctx context.Context) *http.Client {
+	return &http.Client{Transport: &githubTransport{ctx}}
+}
@@ -0,0 +1,210 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGithubTransport(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	remaining := map[string]int{"Bearer a": 0, "Bearer b": 2}
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		requests = append(requests, auth)
+
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset))
+		if remaining[auth] == 0 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(403)
+			return
+		}
+		remaining[auth]--
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(remaining[auth]))
+	}))
+	defer ts.Close()
+
+	oldURL, oldTokens := githubAPIURL, githubTokens
+	githubAPIURL = ts.URL
+	githubTokens = &tokenPool{tokens: []*githubToken{
+		{value: "a", remaining: -1},
+		{value: "b", remaining: -1},
+	}}
+	defer func() { githubAPIURL, githubTokens = oldURL, oldTokens }()
+
+	client := newGithubClient(context.Background())
+	get := func() (int, error) {
+		resp, err := client.Get(ts.URL + "/rate_limit")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	// Token "a" is exhausted, so the request is retried with "b".
+	if status, err := get(); err != nil || status != 200 {
+		t.Fatalf("expect status 200 but got: %d, %v", status, err)
+	}
+	if expect := "Bearer a,Bearer b"; strings.Join(requests, ",") != expect {
+		t.Fatalf("expect requests with %s but got: %s", expect, strings.Join(requests, ","))
+	}
+	if !GitHubRateLimitReset(0).IsZero() {
+		t.Fatal("rate limit is reported to be exceeded")
+	}
+	if !GitHubRateLimitReset(1).Equal(time.Unix(reset, 0)) {
+		t.Fatal("rate limit is not reported to be running low")
+	}
+
+	// Token "b" is used until exhausted, then no more request is sent until reset.
+	if status, err := get(); err != nil || status != 200 {
+		t.Fatalf("expect status 200 but got: %d, %v", status, err)
+	}
+	if _, err := get(); err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Fatalf("expect rate limit error but got: %v", err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("expect 3 requests but got: %d", len(requests))
+	}
+
+	// Response is returned as it is when no other token is available.
+	githubTokens.tokens[1].remaining = -1
+	if status, err := get(); err != nil || status != 403 {
+		t.Fatalf("expect status 403 but got: %d, %v", status, err)
+	}
+
+	// Credentials are not sent to other hosts.
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); len(auth) > 0 {
+			t.Errorf("credentials are sent to other host: %s", auth)
+		}
+	}))
+	defer other.Close()
+	resp, err := client.Get(other.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestGithubAppInstallationToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method != "POST" || r.URL.Path != "/app/installations/42/access_tokens" {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Verify signature and issuer of JWT.
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			t.Errorf("malformed JWT: %v", parts)
+			w.WriteHeader(401)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("verify JWT: %v", err)
+			w.WriteHeader(401)
+			return
+		}
+		var claims struct {
+			Iss string `json:"iss"`
+		}
+		data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if err := json.Unmarshal(data, &claims); err != nil || claims.Iss != "7" {
+			t.Errorf("unexpected claims: %s", data)
+		}
+
+		w.WriteHeader(201)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "installation",
+			"expires_at": time.Now().Add(time.Hour),
+		})
+	}))
+	defer ts.Close()
+
+	oldURL := githubAPIURL
+	githubAPIURL = ts.URL
+	defer func() { githubAPIURL = oldURL }()
+
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	app, err := newGithubApp("7", "42", pemData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token is cached until it's about to expire.
+	for i := 0; i < 2; i++ {
+		token, err := app.installationToken(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		} else if token != "installation" {
+			t.Fatalf("expect token 'installation' but got: %s", token)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expect 1 call but got: %d", calls)
+	}
+}
+
+func TestGitHubRateLimitReset(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	oldTokens := githubTokens
+	defer func() { githubTokens = oldTokens }()
+
+	for _, c := range []struct {
+		limit, remaining int
+		expectLow        bool
+	}{
+		{0, 400, true},    // Limit is unknown.
+		{0, 600, false},   // Limit is unknown.
+		{5000, 400, true}, // Reserve is less than half of limit.
+		{60, 40, false},   // Reserve is capped to half of anonymous limit.
+		{60, 30, true},    // Reserve is capped to half of anonymous limit.
+		{60, -1, false},   // Remaining is unknown.
+		{5000, 0, true},   // Exhausted.
+	} {
+		githubTokens = &tokenPool{tokens: []*githubToken{
+			{limit: c.limit, remaining: c.remaining, reset: reset},
+		}}
+		if low := !GitHubRateLimitReset(500).IsZero(); low != c.expectLow {
+			t.Errorf("limit %d, remaining %d: expect running low to be %v", c.limit, c.remaining, c.expectLow)
+		}
+	}
+}
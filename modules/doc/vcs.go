@@ -18,9 +18,10 @@ package doc
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/xml"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -32,15 +33,9 @@ import (
 
 	"github.com/Unknwon/gowalker/models"
 	"github.com/Unknwon/gowalker/modules/base"
+	"github.com/Unknwon/gowalker/modules/setting"
 )
 
-// TODO: specify with command line flag
-const repoRoot = "/tmp/gw"
-
-func init() {
-	os.RemoveAll(repoRoot)
-}
-
 var urlTemplates = []struct {
 	re       *regexp.Regexp
 	template string
@@ -81,9 +76,12 @@ func lookupURLTemplate(repo, dir, tag string) (string, map[string]string, string
 	return "", nil, ""
 }
 
+// vcsCmd downloads repository at given tag to its checkout directory in the cache,
+// empty tag means the best tag. Given directory of package is either empty
+// or starts with "/".
 type vcsCmd struct {
 	schemes  []string
-	download func([]string, string, string) (string, string, error)
+	download func(ctx context.Context, schemes []string, repo, dir, tag, savedEtag string) (string, string, error)
 }
 
 var vcsCmds = map[string]*vcsCmd{
@@ -91,15 +89,39 @@ var vcsCmds = map[string]*vcsCmd{
 		schemes:  []string{"http", "https", "git"},
 		download: downloadGit,
 	},
+	"hg": &vcsCmd{
+		schemes:  []string{"https", "http"},
+		download: downloadHg,
+	},
+	"svn": &vcsCmd{
+		schemes:  []string{"https", "http", "svn"},
+		download: downloadSVN,
+	},
+	"bzr": &vcsCmd{
+		schemes:  []string{"https", "http", "bzr"},
+		download: downloadBzr,
+	},
 }
 
-var lsremoteRe = regexp.MustCompile(`(?m)^([0-9a-f]{40})\s+refs/(?:tags|heads)/(.+)$`)
+// runVCS runs command of version control system in given directory and returns its output.
+func runVCS(ctx context.Context, dir, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	log.Println(strings.Join(cmd.Args, " "))
+	return cmd.Output()
+}
+
+var lsremoteRe = regexp.MustCompile(`(?m)^([0-9a-f]{40})\s+refs/(tags|heads)/(.+)$`)
 
-func downloadGit(schemes []string, repo, savedEtag string) (string, string, error) {
+// downloadGit fetches given tag or branch into a shallow clone and checks it out,
+// blobs are fetched on demand so large repositories can be checked out
+// sparsely for directories of requested packages.
+// Git processes are killed when given context is done.
+func downloadGit(ctx context.Context, schemes []string, repo, dir, tag, savedEtag string) (string, string, error) {
 	var p []byte
 	var scheme string
 	for i := range schemes {
-		cmd := exec.Command("git", "ls-remote", "--heads", "--tags", schemes[i]+"://"+repo+".git")
+		cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", schemes[i]+"://"+repo+".git")
 		log.Println(strings.Join(cmd.Args, " "))
 		var err error
 		p, err = cmd.Output()
@@ -114,11 +136,15 @@ func downloadGit(schemes []string, repo, savedEtag string) (string, string, erro
 	}
 
 	tags := make(map[string]string)
+	refs := make(map[string]string)
 	for _, m := range lsremoteRe.FindAllSubmatch(p, -1) {
-		tags[string(m[2])] = string(m[1])
+		// Peeled commit of annotated tag comes right after the tag object.
+		name := strings.TrimSuffix(string(m[3]), "^{}")
+		tags[name] = string(m[1])
+		refs[name] = "refs/" + string(m[2]) + "/" + name
 	}
 
-	tag, commit, err := bestTag(tags, "master")
+	tag, commit, err := pickTag(tags, tag, defaultTags["git"])
 	if err != nil {
 		return "", "", err
 	}
@@ -129,35 +155,276 @@ func downloadGit(schemes []string, repo, savedEtag string) (string, string, erro
 		return "", "", ErrPackageNotModified
 	}
 
-	dir := path.Join(repoRoot, repo+".git")
-	p, err = ioutil.ReadFile(path.Join(dir, ".git/HEAD"))
+	root := vcsDir(repo, "git")
+	if !com.IsDir(path.Join(root, ".git")) {
+		if err = os.MkdirAll(root, 0777); err != nil {
+			return "", "", err
+		}
+		if _, err = runVCS(ctx, root, "git", "init", "--quiet"); err == nil {
+			_, err = runVCS(ctx, root, "git", "remote", "add", "origin", scheme+"://"+repo+".git")
+		}
+		if err != nil {
+			os.RemoveAll(root)
+			return "", "", err
+		}
+	}
+
+	if p, _ = runVCS(ctx, root, "git", "rev-parse", "HEAD"); string(bytes.TrimSpace(p)) != commit {
+		if _, err = runVCS(ctx, root, "git", "fetch", "--quiet", "--depth", "1", "--filter=blob:none", "origin", refs[tag]); err != nil {
+			return "", "", err
+		}
+	}
+
+	if err = sparseCheckout(ctx, root, commit, dir); err != nil {
+		return "", "", fmt.Errorf("sparse checkout: %v", err)
+	}
+	if _, err = runVCS(ctx, root, "git", "checkout", "--quiet", "--detach", "--force", commit); err != nil {
+		return "", "", err
+	}
+
+	return tag, etag, nil
+}
+
+// sparseCheckout limits checkout of repository with too many files to given
+// directory and ones checked out before. All files in sub-directories are
+// included by cone mode, so empty directory means the whole repository.
+func sparseCheckout(ctx context.Context, root, commit, dir string) error {
+	p, _ := runVCS(ctx, root, "git", "config", "core.sparseCheckout")
+	isSparse := string(bytes.TrimSpace(p)) == "true"
+
+	var err error
+	switch {
+	case len(dir) == 0:
+		if isSparse {
+			_, err = runVCS(ctx, root, "git", "sparse-checkout", "disable")
+		}
+	case isSparse:
+		_, err = runVCS(ctx, root, "git", "sparse-checkout", "add", dir[1:])
+	case setting.VCSSparseFiles > 0:
+		// Trees are fetched by shallow clone, so files can be counted without blobs.
+		if p, err = runVCS(ctx, root, "git", "ls-tree", "-r", "--name-only", commit); err != nil {
+			return err
+		}
+		if bytes.Count(p, []byte("\n")) > setting.VCSSparseFiles {
+			_, err = runVCS(ctx, root, "git", "sparse-checkout", "set", "--cone", dir[1:])
+		}
+	}
+	return err
+}
+
+// downloadHg clones or pulls repository and updates to given tag, the default
+// branch and given or go1 tag are identified remotely like git ls-remote.
+func downloadHg(ctx context.Context, schemes []string, repo, dir, tag, savedEtag string) (string, string, error) {
+	defaultTag := defaultTags["hg"]
+	tags := make(map[string]string)
+	var scheme string
+	for i := range schemes {
+		p, err := runVCS(ctx, "", "hg", "identify", "--id", "--rev", defaultTag, schemes[i]+"://"+repo)
+		if err == nil {
+			scheme = schemes[i]
+			tags[defaultTag] = string(bytes.TrimSpace(p))
+			break
+		}
+	}
+
+	if scheme == "" {
+		return "", "", com.NotFoundError{"VCS not found"}
+	}
+
+	rev := tag
+	if len(rev) == 0 {
+		rev = "go1"
+	}
+	if p, err := runVCS(ctx, "", "hg", "identify", "--id", "--rev", rev, scheme+"://"+repo); err == nil {
+		tags[rev] = string(bytes.TrimSpace(p))
+	}
+
+	tag, commit, err := pickTag(tags, tag, defaultTag)
+	if err != nil {
+		return "", "", err
+	}
+
+	etag := scheme + "-" + commit
+
+	if etag == savedEtag {
+		return "", "", ErrPackageNotModified
+	}
+
+	root := vcsDir(repo, "hg")
+	p, err := runVCS(ctx, "", "hg", "identify", "--id", "-R", root)
 	switch {
 	case err != nil:
-		if err := os.MkdirAll(dir, 0777); err != nil {
+		if err := os.MkdirAll(path.Dir(root), 0777); err != nil {
 			return "", "", err
 		}
-		cmd := exec.Command("git", "clone", scheme+"://"+repo, dir)
-		log.Println(strings.Join(cmd.Args, " "))
-		if err := cmd.Run(); err != nil {
+		if _, err := runVCS(ctx, "", "hg", "clone", "--updaterev", commit, scheme+"://"+repo, root); err != nil {
+			// Do not leave a partial clone behind.
+			os.RemoveAll(root)
 			return "", "", err
 		}
-	case string(bytes.TrimRight(p, "\n")) == commit:
 		return tag, etag, nil
-	default:
-		cmd := exec.Command("git", "fetch")
-		log.Println(strings.Join(cmd.Args, " "))
-		cmd.Dir = dir
-		if err := cmd.Run(); err != nil {
+	case string(bytes.TrimSpace(p)) == commit:
+		return tag, etag, nil
+	}
+
+	if _, err = runVCS(ctx, "", "hg", "pull", "-R", root); err != nil {
+		return "", "", err
+	}
+	if _, err = runVCS(ctx, "", "hg", "update", "-R", root, "--clean", "--rev", commit); err != nil {
+		return "", "", err
+	}
+
+	return tag, etag, nil
+}
+
+// getSVNRevision returns last changed revision of given URL or working copy.
+func getSVNRevision(ctx context.Context, target string) (string, error) {
+	p, err := runVCS(ctx, "", "svn", "info", "--xml", "--non-interactive", target)
+	if err != nil {
+		return "", err
+	}
+
+	var info struct {
+		Entry struct {
+			Commit struct {
+				Revision string `xml:"revision,attr"`
+			} `xml:"commit"`
+		} `xml:"entry"`
+	}
+	if err = xml.Unmarshal(p, &info); err != nil {
+		return "", fmt.Errorf("parse svn info: %v", err)
+	} else if len(info.Entry.Commit.Revision) == 0 {
+		return "", errors.New("last changed revision not found")
+	}
+	return info.Entry.Commit.Revision, nil
+}
+
+// downloadSVN checks out or updates repository to its last changed revision.
+// Like go get, the whole repository is checked out and there is no tag,
+// so the revision is returned in place of the tag and no tag can be given.
+func downloadSVN(ctx context.Context, schemes []string, repo, dir, tag, savedEtag string) (string, string, error) {
+	if len(tag) > 0 {
+		return "", "", com.NotFoundError{"Subversion repository has no tag: " + tag}
+	}
+
+	var scheme, rev string
+	for i := range schemes {
+		var err error
+		rev, err = getSVNRevision(ctx, schemes[i]+"://"+repo)
+		if err == nil {
+			scheme = schemes[i]
+			break
+		}
+	}
+
+	if scheme == "" {
+		return "", "", com.NotFoundError{"VCS not found"}
+	}
+
+	etag := scheme + "-" + rev
+
+	if etag == savedEtag {
+		return "", "", ErrPackageNotModified
+	}
+
+	root := vcsDir(repo, "svn")
+	localRev, err := getSVNRevision(ctx, root)
+	switch {
+	case err != nil:
+		if err := os.MkdirAll(path.Dir(root), 0777); err != nil {
+			return "", "", err
+		}
+		if _, err := runVCS(ctx, "", "svn", "checkout", "--non-interactive", "-r", rev, scheme+"://"+repo, root); err != nil {
+			// Do not leave a partial checkout behind.
+			os.RemoveAll(root)
+			return "", "", err
+		}
+	case localRev != rev:
+		if _, err = runVCS(ctx, root, "svn", "update", "--non-interactive", "-r", rev); err != nil {
 			return "", "", err
 		}
 	}
 
-	cmd := exec.Command("git", "checkout", "--detach", "--force", commit)
-	cmd.Dir = dir
-	if err := cmd.Run(); err != nil {
+	return rev, etag, nil
+}
+
+// getBzrRevision returns revision ID of given revision in branch of URL or directory,
+// empty revision means the last one.
+func getBzrRevision(ctx context.Context, target, rev string) (string, error) {
+	args := []string{"revision-info", "-d", target}
+	if len(rev) > 0 {
+		args = append(args, "-r", rev)
+	}
+	p, err := runVCS(ctx, "", "bzr", args...)
+	if err != nil {
+		return "", err
+	}
+
+	// Output is in format of "<revno> <revision-id>".
+	fields := strings.Fields(string(p))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected revision info: %s", p)
+	}
+	return fields[1], nil
+}
+
+// downloadBzr branches or pulls repository at given tag, the last revision
+// and given or go1 tag are looked up remotely like git ls-remote.
+func downloadBzr(ctx context.Context, schemes []string, repo, dir, tag, savedEtag string) (string, string, error) {
+	defaultTag := defaultTags["bzr"]
+	tags := make(map[string]string)
+	var scheme string
+	for i := range schemes {
+		revID, err := getBzrRevision(ctx, schemes[i]+"://"+repo, defaultTag)
+		if err == nil {
+			scheme = schemes[i]
+			tags[defaultTag] = revID
+			break
+		}
+	}
+
+	if scheme == "" {
+		return "", "", com.NotFoundError{"VCS not found"}
+	}
+
+	name := tag
+	if len(name) == 0 {
+		name = "go1"
+	}
+	if revID, err := getBzrRevision(ctx, scheme+"://"+repo, "tag:"+name); err == nil {
+		tags[name] = revID
+	}
+
+	tag, revID, err := pickTag(tags, tag, defaultTag)
+	if err != nil {
 		return "", "", err
 	}
 
+	etag := scheme + "-" + revID
+
+	if etag == savedEtag {
+		return "", "", ErrPackageNotModified
+	}
+
+	root := vcsDir(repo, "bzr")
+	localRevID, err := getBzrRevision(ctx, root, "")
+	switch {
+	case err != nil:
+		if err := os.MkdirAll(path.Dir(root), 0777); err != nil {
+			return "", "", err
+		}
+		if _, err := runVCS(ctx, "", "bzr", "branch", "-r", "revid:"+revID, scheme+"://"+repo, root); err != nil {
+			// Do not leave a partial branch behind.
+			os.RemoveAll(root)
+			return "", "", err
+		}
+	case localRevID != revID:
+		// Tag may be moved backward, so overwrite local branch.
+		if _, err = runVCS(ctx, "", "bzr", "pull", "-d", root, "--overwrite", "-r", "revid:"+revID, scheme+"://"+repo); err != nil {
+			return "", "", err
+		}
+	}
+
 	return tag, etag, nil
 }
 
@@ -166,11 +433,11 @@ var (
 	gopkgPathPattern = regexp.MustCompile(`^/(?:([a-zA-Z0-9][-a-zA-Z0-9]+)/)?([a-zA-Z][-.a-zA-Z0-9]*)\.((?:v0|v[1-9][0-9]*)(?:\.0|\.[1-9][0-9]*){0,2})(?:\.git)?((?:/[a-zA-Z0-9][-.a-zA-Z0-9]*)*)$`)
 )
 
-func getVCSDoc(match map[string]string, etagSaved string) (*Package, error) {
+func getVCSDoc(ctx context.Context, match map[string]string, etagSaved string) (*Package, error) {
 	if strings.HasPrefix(match["importPath"], "golang.org/x/") {
 		match["owner"] = "golang"
 		match["repo"] = path.Dir(strings.TrimPrefix(match["importPath"], "golang.org/x/"))
-		return getGithubDoc(match, etagSaved)
+		return getGithubDoc(ctx, match, etagSaved)
 	} else if strings.HasPrefix(match["importPath"], "gopkg.in/") {
 		m := gopkgPathPattern.FindStringSubmatch(strings.TrimPrefix(match["importPath"], "gopkg.in"))
 		if m == nil {
@@ -184,7 +451,7 @@ func getVCSDoc(match map[string]string, etagSaved string) (*Package, error) {
 		match["owner"] = user
 		match["repo"] = repo
 		match["tag"] = m[3]
-		return getGithubDoc(match, etagSaved)
+		return getGithubDoc(ctx, match, etagSaved)
 	}
 
 	cmd := vcsCmds[match["vcs"]]
@@ -210,74 +477,67 @@ func getVCSDoc(match map[string]string, etagSaved string) (*Package, error) {
 		}
 	}
 
-	// Download and checkout.
+	// Nothing is run, removed or walked outside the cache.
+	if !isValidRepoPath(match["repo"]) || !isValidRepoPath(match["repo"]+match["dir"]) {
+		return nil, fmt.Errorf("invalid repository path: %s%s", match["repo"], match["dir"])
+	}
+
+	// Download and checkout, the checkout is not evicted while it's being walked.
+	root := vcsDir(match["repo"], match["vcs"])
+	defer lockRepo(root)()
 
-	tag, _, err := cmd.download(schemes, match["repo"], etagSaved)
+	setJobState(ctx, JOB_DOWNLOADING)
+	tag, etag, err := cmd.download(ctx, schemes, match["repo"], match["dir"], match["tag"], etagSaved)
 	if err != nil {
 		return nil, err
 	}
 
-	// Find source location.
+	d := path.Join(root, match["dir"])
+	if !com.IsDir(d) {
+		return nil, com.NotFoundError{"Directory not found: " + match["dir"]}
+	}
 
+	// Find source location.
+	var browseUrlTpl string
 	urlTemplate, urlMatch, lineFmt := lookupURLTemplate(match["repo"], match["dir"], tag)
-
-	// Slurp source files.
-
-	d := path.Join(repoRoot, com.Expand("{repo}.{vcs}", match), match["dir"])
-	f, err := os.Open(d)
-	if err != nil {
-		if os.IsNotExist(err) {
-			err = com.NotFoundError{err.Error()}
-		}
-		return nil, err
-	}
-	fis, err := f.Readdir(-1)
-	if err != nil {
-		return nil, err
+	if urlMatch != nil {
+		urlMatch["0"] = "{0}"
+		browseUrlTpl = com.Expand(urlTemplate, urlMatch)
 	}
 
-	// Get source file data.
-	var files []com.RawFile
-	for _, fi := range fis {
-		if fi.IsDir() || !base.IsDocFile(fi.Name()) {
-			continue
-		}
-		b, err := ioutil.ReadFile(path.Join(d, fi.Name()))
-		if err != nil {
-			return nil, err
-		}
-		files = append(files, &Source{
-			SrcName:   fi.Name(),
-			BrowseUrl: com.Expand(urlTemplate, urlMatch, fi.Name()),
-			SrcData:   b,
-		})
+	projectPath := match["projectRoot"]
+	if len(projectPath) == 0 {
+		projectPath = com.Expand("{repo}.{vcs}", match)
 	}
 
-	// Start generating data.
 	w := &Walker{
 		LineFmt: lineFmt,
 		Pdoc: &Package{
 			PkgInfo: &models.PkgInfo{
-				ImportPath: match["importPath"],
+				ImportPath:  match["importPath"],
+				ProjectPath: projectPath,
+				Etag:        etag,
 			},
 		},
 	}
 
-	srcs := make([]*Source, 0, len(files))
-	for _, f := range files {
-		s, _ := f.(*Source)
-		srcs = append(srcs, s)
-	}
-
-	return w.Build(&WalkRes{
-		WalkDepth: WD_All,
-		WalkType:  WT_Memory,
-		WalkMode:  WM_All,
-		Srcs:      srcs,
+	setJobState(ctx, JOB_WALKING)
+	pdoc, err := w.Build(&WalkRes{
+		WalkDepth:    WD_All,
+		WalkType:     WT_Local,
+		WalkMode:     WM_All,
+		RootPath:     d,
+		BrowseUrlTpl: browseUrlTpl,
 	})
+	if err != nil {
+		return nil, fmt.Errorf("walk package: %v", err)
+	} else if len(pdoc.Files) == 0 && len(pdoc.Dirs) == 0 {
+		return nil, ErrPackageNoGoFile
+	}
+	return pdoc, nil
 }
 
-var defaultTags = map[string]string{"git": "master", "hg": "default", "svn": "trunk"}
+var defaultTags = map[string]string{"git": "master", "hg": "default", "svn": "trunk", "bzr": "last:1"}
 
 func bestTag(tags map[string]string, defaultTag string) (string, string, error) {
 	if commit, ok := tags["go1"]; ok {
@@ -289,6 +549,17 @@ func bestTag(tags map[string]string, defaultTag string) (string, string, error)
 	return "", "", com.NotFoundError{"Tag or branch not found."}
 }
 
+// pickTag returns given tag and its commit, or the best tag if no tag is given.
+func pickTag(tags map[string]string, tag, defaultTag string) (string, string, error) {
+	if len(tag) == 0 {
+		return bestTag(tags, defaultTag)
+	}
+	if commit, ok := tags[tag]; ok {
+		return tag, commit, nil
+	}
+	return "", "", com.NotFoundError{"Tag or branch not found: " + tag}
+}
+
 // checkDir checks if directory has been appended to slice.
 func checkDir(dir string, dirs []string) bool {
 	for _, d := range dirs {
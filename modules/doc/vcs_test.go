@@ -0,0 +1,332 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+// newTestRepoDir returns a temporary directory for repositories and uses its
+// "cache" sub-directory as the cache, test is skipped if any of given
+// commands is not installed.
+func newTestRepoDir(t *testing.T, cmds ...string) (string, func()) {
+	for _, name := range cmds {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not installed", name)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gw-vcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldPath := setting.VCSCachePath
+	setting.VCSCachePath = path.Join(dir, "cache")
+	return dir, func() {
+		setting.VCSCachePath = oldPath
+		os.RemoveAll(dir)
+	}
+}
+
+// runTestCmd runs command in given directory and returns its trimmed output.
+func runTestCmd(t *testing.T, dir, name string, args ...string) string {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	p, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", strings.Join(cmd.Args, " "), err, p)
+	}
+	return strings.TrimSpace(string(p))
+}
+
+func writeTestFile(t *testing.T, name string) {
+	if err := ioutil.WriteFile(name, []byte("package hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testDownload downloads local repository through "file" scheme and checks
+// the result and existence of given file in the checkout.
+func testDownload(t *testing.T, vcs, repo, expectTag, expectEtag, file string) {
+	download := vcsCmds[vcs].download
+	tag, etag, err := download(context.Background(), []string{"file"}, repo, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != expectTag || etag != expectEtag {
+		t.Fatalf("expect tag and etag %s, %s but got: %s, %s", expectTag, expectEtag, tag, etag)
+	}
+	if !com.IsFile(path.Join(vcsDir(repo, vcs), file)) {
+		t.Fatalf("%s is not checked out", file)
+	}
+
+	if _, _, err = download(context.Background(), []string{"file"}, repo, "", "", etag); err != ErrPackageNotModified {
+		t.Fatalf("expect ErrPackageNotModified but got: %v", err)
+	}
+}
+
+func TestDownloadGit(t *testing.T) {
+	tmp, cleanup := newTestRepoDir(t, "git")
+	defer cleanup()
+
+	// Remote URL has ".git" suffix which is not part of the repository path.
+	src := path.Join(tmp, "hello")
+	runTestCmd(t, tmp, "git", "init", "--quiet", src+".git")
+	runTestCmd(t, src+".git", "git", "config", "user.name", "test")
+	runTestCmd(t, src+".git", "git", "config", "user.email", "test@example.com")
+	writeTestFile(t, path.Join(src+".git", "hello.go"))
+	runTestCmd(t, src+".git", "git", "add", "-A")
+	runTestCmd(t, src+".git", "git", "commit", "-m", "init")
+	runTestCmd(t, src+".git", "git", "tag", "-a", "-m", "go1", "go1")
+	writeTestFile(t, path.Join(src+".git", "world.go"))
+	runTestCmd(t, src+".git", "git", "add", "-A")
+	runTestCmd(t, src+".git", "git", "commit", "-m", "world")
+
+	// Annotated tag is resolved to its commit.
+	go1 := runTestCmd(t, src+".git", "git", "rev-parse", "go1^{commit}")
+	testDownload(t, "git", src, "go1", "file-"+go1, "hello.go")
+	if com.IsExist(path.Join(vcsDir(src, "git"), "world.go")) {
+		t.Fatal("world.go is checked out but not tagged")
+	}
+
+	// Existing clone is fetched after tag is moved.
+	runTestCmd(t, src+".git", "git", "tag", "-f", "go1")
+	go1 = runTestCmd(t, src+".git", "git", "rev-parse", "go1")
+	testDownload(t, "git", src, "go1", "file-"+go1, "world.go")
+
+	// Requested tag is checked out instead of the best one.
+	runTestCmd(t, src+".git", "git", "tag", "v1.0.0", "HEAD~1")
+	v1 := runTestCmd(t, src+".git", "git", "rev-parse", "v1.0.0")
+	tag, etag, err := downloadGit(context.Background(), []string{"file"}, src, "", "v1.0.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "v1.0.0" || etag != "file-"+v1 {
+		t.Fatalf("expect tag and etag v1.0.0, file-%s but got: %s, %s", v1, tag, etag)
+	}
+	if com.IsExist(path.Join(vcsDir(src, "git"), "world.go")) {
+		t.Fatal("world.go is checked out but not in v1.0.0")
+	}
+
+	// Unknown tag is not replaced by the best one.
+	_, _, err = downloadGit(context.Background(), []string{"file"}, src, "", "v2.0.0", "")
+	if _, ok := err.(com.NotFoundError); !ok {
+		t.Fatalf("expect not found error but got: %v", err)
+	}
+}
+
+func TestGetVCSDocSparse(t *testing.T) {
+	tmp, cleanup := newTestRepoDir(t, "git")
+	defer cleanup()
+
+	oldFiles := setting.VCSSparseFiles
+	setting.VCSSparseFiles = 2
+	defer func() { setting.VCSSparseFiles = oldFiles }()
+
+	src := path.Join(tmp, "hello")
+	// Name default branch explicitly, "--initial-branch" requires Git 2.28.
+	runTestCmd(t, tmp, "git", "init", "--quiet", src+".git")
+	runTestCmd(t, src+".git", "git", "symbolic-ref", "HEAD", "refs/heads/master")
+	runTestCmd(t, src+".git", "git", "config", "user.name", "test")
+	runTestCmd(t, src+".git", "git", "config", "user.email", "test@example.com")
+	for _, name := range []string{"hello.go", "a/a.go", "a/sub/sub.go", "b/b.go"} {
+		os.MkdirAll(path.Dir(path.Join(src+".git", name)), os.ModePerm)
+		writeTestFile(t, path.Join(src+".git", name))
+	}
+	runTestCmd(t, src+".git", "git", "add", "-A")
+	runTestCmd(t, src+".git", "git", "commit", "-m", "init")
+
+	oldSchemes := vcsCmds["git"].schemes
+	vcsCmds["git"].schemes = []string{"file"}
+	defer func() { vcsCmds["git"].schemes = oldSchemes }()
+
+	match := map[string]string{
+		"importPath": "example.com/hello/a",
+		"repo":       src,
+		"vcs":        "git",
+		"dir":        "/a",
+	}
+	pdoc, err := getVCSDoc(context.Background(), match, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdoc.ImportPath != "example.com/hello/a" || pdoc.Subdirs != "sub" || len(pdoc.Etag) == 0 {
+		t.Fatalf("unexpected import path, subdirs or etag: %s, %s, %s", pdoc.ImportPath, pdoc.Subdirs, pdoc.Etag)
+	}
+
+	// Only directory of the package is checked out.
+	root := vcsDir(src, "git")
+	if !com.IsFile(path.Join(root, "a/sub/sub.go")) || com.IsExist(path.Join(root, "b/b.go")) {
+		t.Fatal("repository is not checked out sparsely")
+	}
+
+	// Directories of other packages are added to checkout.
+	match["dir"] = "/b"
+	if _, err = getVCSDoc(context.Background(), match, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !com.IsFile(path.Join(root, "a/a.go")) || !com.IsFile(path.Join(root, "b/b.go")) {
+		t.Fatal("directory is not added to checkout")
+	}
+}
+
+func TestIsValidRepoPath(t *testing.T) {
+	_, cleanup := newTestRepoDir(t)
+	defer cleanup()
+
+	for repo, expect := range map[string]bool{
+		"example.com/hello":                 true,
+		"example.com/hello/a..b":            true,
+		"/tmp/hello":                        true,
+		"evil.example/../../../../srv/data": false,
+		"example.com/hello/../../etc":       false,
+		"..":                                false,
+		"":                                  false,
+	} {
+		if isValidRepoPath(repo) != expect {
+			t.Errorf("%q: expect %v", repo, expect)
+		}
+	}
+
+	// Directory of package is checked along with repository.
+	_, err := getVCSDoc(context.Background(), map[string]string{
+		"importPath": "example.com/hello",
+		"repo":       "example.com/hello",
+		"vcs":        "git",
+		"dir":        "/../../etc",
+	}, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid repository path") {
+		t.Fatalf("expect invalid repository path but got: %v", err)
+	}
+}
+
+func TestEvictRepos(t *testing.T) {
+	_, cleanup := newTestRepoDir(t)
+	defer cleanup()
+
+	oldSize := setting.VCSCacheMaxSize
+	setting.VCSCacheMaxSize = 250
+	defer func() { setting.VCSCacheMaxSize = oldSize }()
+
+	// Every repository has 100 bytes, "a" is the least recently used but locked.
+	for i, repo := range []string{"example.com/a", "example.com/b", "example.com/c", "example.com/d"} {
+		dir := vcsDir(repo, "git")
+		os.MkdirAll(path.Join(dir, ".git"), os.ModePerm)
+		if err := ioutil.WriteFile(path.Join(dir, "hello.go"), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(time.Duration(i-10) * time.Hour)
+		os.Chtimes(dir, modTime, modTime)
+	}
+	unlock := lockRepo(vcsDir("example.com/a", "git"))
+	evictRepos()
+	unlock()
+
+	for repo, expect := range map[string]bool{
+		"example.com/a": true,
+		"example.com/b": false,
+		"example.com/c": false,
+		"example.com/d": true,
+	} {
+		if com.IsExist(vcsDir(repo, "git")) != expect {
+			t.Errorf("expect existence of %s to be %v", repo, expect)
+		}
+	}
+}
+
+func TestDownloadHg(t *testing.T) {
+	tmp, cleanup := newTestRepoDir(t, "hg")
+	defer cleanup()
+
+	src := path.Join(tmp, "hello")
+	runTestCmd(t, tmp, "hg", "init", src)
+	writeTestFile(t, path.Join(src, "hello.go"))
+	runTestCmd(t, src, "hg", "commit", "-A", "-u", "test", "-m", "init")
+
+	// Tagging makes a new commit, so the default branch is ahead of go1.
+	runTestCmd(t, src, "hg", "tag", "-u", "test", "go1")
+	go1 := runTestCmd(t, src, "hg", "identify", "--id", "--rev", "go1")
+	testDownload(t, "hg", src, "go1", "file-"+go1, "hello.go")
+
+	// Existing clone is pulled and updated after tag is moved.
+	writeTestFile(t, path.Join(src, "world.go"))
+	runTestCmd(t, src, "hg", "commit", "-A", "-u", "test", "-m", "world")
+	runTestCmd(t, src, "hg", "tag", "-f", "-u", "test", "go1")
+	go1 = runTestCmd(t, src, "hg", "identify", "--id", "--rev", "go1")
+	testDownload(t, "hg", src, "go1", "file-"+go1, "world.go")
+}
+
+func TestDownloadSVN(t *testing.T) {
+	tmp, cleanup := newTestRepoDir(t, "svn", "svnadmin")
+	defer cleanup()
+
+	src := path.Join(tmp, "hello")
+	wc := path.Join(tmp, "wc")
+	runTestCmd(t, tmp, "svnadmin", "create", src)
+	runTestCmd(t, tmp, "svn", "checkout", "file://"+src, wc)
+	writeTestFile(t, path.Join(wc, "hello.go"))
+	runTestCmd(t, wc, "svn", "add", "hello.go")
+	runTestCmd(t, wc, "svn", "commit", "-m", "init")
+	testDownload(t, "svn", src, "1", "file-1", "hello.go")
+
+	// Existing checkout is updated.
+	writeTestFile(t, path.Join(wc, "world.go"))
+	runTestCmd(t, wc, "svn", "add", "world.go")
+	runTestCmd(t, wc, "svn", "commit", "-m", "world")
+	testDownload(t, "svn", src, "2", "file-2", "world.go")
+}
+
+func TestDownloadBzr(t *testing.T) {
+	tmp, cleanup := newTestRepoDir(t, "bzr")
+	defer cleanup()
+
+	oldEmail := os.Getenv("BZR_EMAIL")
+	os.Setenv("BZR_EMAIL", "test <test@example.com>")
+	defer os.Setenv("BZR_EMAIL", oldEmail)
+
+	src := path.Join(tmp, "hello")
+	runTestCmd(t, tmp, "bzr", "init", src)
+	writeTestFile(t, path.Join(src, "hello.go"))
+	runTestCmd(t, src, "bzr", "add")
+	runTestCmd(t, src, "bzr", "commit", "-m", "init")
+	runTestCmd(t, src, "bzr", "tag", "go1")
+	writeTestFile(t, path.Join(src, "world.go"))
+	runTestCmd(t, src, "bzr", "add")
+	runTestCmd(t, src, "bzr", "commit", "-m", "world")
+
+	// The go1 tag is preferred over the last revision.
+	go1 := strings.Fields(runTestCmd(t, src, "bzr", "revision-info", "-r", "tag:go1"))[1]
+	testDownload(t, "bzr", src, "go1", "file-"+go1, "hello.go")
+	if com.IsExist(path.Join(vcsDir(src, "bzr"), "world.go")) {
+		t.Fatal("world.go is checked out but not tagged")
+	}
+
+	// Existing branch is pulled after tag is moved.
+	runTestCmd(t, src, "bzr", "tag", "--force", "go1")
+	go1 = strings.Fields(runTestCmd(t, src, "bzr", "revision-info", "-r", "tag:go1"))[1]
+	testDownload(t, "bzr", src, "go1", "file-"+go1, "world.go")
+}
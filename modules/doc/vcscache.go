@@ -0,0 +1,182 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Unknwon/com"
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+// Repositories are checked out in the cache directory and kept across restarts,
+// least recently used ones are evicted periodically when total size exceeds
+// the limit.
+
+// EVICT_SCHEDULE is cron spec of how often to check size of the cache, which
+// walks the whole cache so it's not done after every download.
+const EVICT_SCHEDULE = "@every 10m"
+
+// vcsDir returns checkout directory of repository in the cache.
+func vcsDir(repo, vcs string) string {
+	return path.Join(setting.VCSCachePath, repo+"."+vcs)
+}
+
+// isValidRepoPath returns true if checkout directory of repository is inside
+// the cache, repository path may come from meta tag of any remote host.
+func isValidRepoPath(repo string) bool {
+	for _, elem := range strings.Split(repo, "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+	return strings.HasPrefix(vcsDir(repo, ""), path.Clean(setting.VCSCachePath)+"/")
+}
+
+type repoLock struct {
+	sync.Mutex
+	refs int
+}
+
+var vcsCache = struct {
+	sync.Mutex
+	locks map[string]*repoLock
+}{locks: make(map[string]*repoLock)}
+
+// lockRepo locks checkout directory for exclusive use, it's never evicted
+// until the returned function is called to unlock and mark it as recently used.
+func lockRepo(dir string) func() {
+	vcsCache.Lock()
+	l := vcsCache.locks[dir]
+	if l == nil {
+		l = &repoLock{}
+		vcsCache.locks[dir] = l
+	}
+	l.refs++
+	vcsCache.Unlock()
+
+	l.Lock()
+	return func() {
+		now := time.Now()
+		os.Chtimes(dir, now, now)
+		l.Unlock()
+
+		vcsCache.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(vcsCache.locks, dir)
+		}
+		vcsCache.Unlock()
+	}
+}
+
+type cachedRepo struct {
+	dir     string
+	size    int64
+	modTime time.Time
+}
+
+// isRepoDir returns true if directory is a checkout of any supported VCS.
+func isRepoDir(dir string) bool {
+	ext := path.Ext(dir)
+	return vcsCmds[ext[1:]] != nil && com.IsDir(filepath.Join(dir, ext))
+}
+
+// listCachedRepos returns all checked out repositories in the cache.
+func listCachedRepos() ([]*cachedRepo, error) {
+	var repos []*cachedRepo
+	var cur *cachedRepo
+	err := filepath.Walk(setting.VCSCachePath, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if cur != nil && len(fpath) > len(cur.dir) && fpath[:len(cur.dir)+1] == cur.dir+string(filepath.Separator) {
+			if !fi.IsDir() {
+				cur.size += fi.Size()
+			}
+			return nil
+		}
+		cur = nil
+
+		if fi.IsDir() && len(path.Ext(fi.Name())) > 1 && isRepoDir(fpath) {
+			cur = &cachedRepo{
+				dir:     fpath,
+				modTime: fi.ModTime(),
+			}
+			repos = append(repos, cur)
+		}
+		return nil
+	})
+	return repos, err
+}
+
+var evicting int32
+
+// evictRepos removes least recently used repositories until total size
+// of the cache is under the limit, repositories in use are skipped.
+func evictRepos() {
+	if setting.VCSCacheMaxSize <= 0 || !atomic.CompareAndSwapInt32(&evicting, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&evicting, 0)
+
+	repos, err := listCachedRepos()
+	if err != nil {
+		log.Error("Fail to list cached repositories: %v", err)
+		return
+	}
+
+	var total int64
+	for _, r := range repos {
+		total += r.size
+	}
+	if total <= setting.VCSCacheMaxSize {
+		return
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].modTime.Before(repos[j].modTime)
+	})
+	for _, r := range repos {
+		if total <= setting.VCSCacheMaxSize {
+			break
+		}
+
+		// Hold the lock so it cannot be locked for use during removal.
+		vcsCache.Lock()
+		if vcsCache.locks[filepath.ToSlash(r.dir)] == nil {
+			if err = os.RemoveAll(r.dir); err != nil {
+				log.Error("Fail to evict repository '%s': %v", r.dir, err)
+			} else {
+				log.Info("Repository evicted: %s", r.dir)
+				total -= r.size
+			}
+		}
+		vcsCache.Unlock()
+	}
+}
@@ -16,7 +16,10 @@
 package doc
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -29,12 +32,15 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/Unknwon/com"
+
+	"github.com/Unknwon/gowalker/modules/base"
 )
 
 // WalkDepth indicates how far the process goes.
@@ -69,17 +75,232 @@ type WalkRes struct {
 	WalkDepth
 	WalkType
 	WalkMode
-	RootPath string    // For WT_Local mode.
-	Srcs     []*Source // For WT_Memory mode.
-	BuildAll bool
+	RootPath     string    // For WT_Local mode, or directory in archive for WT_Zip and WT_TarGz mode.
+	BrowseUrlTpl string    // For WT_Local, WT_Zip and WT_TarGz mode, {0} is replaced by file name.
+	Archive      []byte    // For WT_Zip and WT_TarGz mode.
+	Srcs         []*Source // For WT_Memory mode.
+	BuildAll     bool
+}
+
+// setDirs sets all subdirectories and shows direct ones as sub-packages.
+// A direct subdirectory without Go files is still shown when there are
+// packages in deeper levels of it.
+func (w *Walker) setDirs(dirs []string) {
+	w.Pdoc.Dirs = dirs
+
+	subdirMap := make(map[string]bool)
+	for _, d := range dirs {
+		if i := strings.Index(d, "/"); i > -1 {
+			d = d[:i]
+		}
+		subdirMap[d] = true
+	}
+	w.Pdoc.Subdirs = strings.Join(base.MapToSortedStrings(subdirMap), "|")
 }
 
 // ------------------------------
 // WT_Local
 // ------------------------------
 
-func (w *Walker) setLocalContext(ctxt *build.Context) {
-	ctxt.IsAbsPath = path.IsAbs
+// isSkipDir returns true if given directory name should not be walked.
+func isSkipDir(name string) bool {
+	return len(name) == 0 || name[0] == '.' || name[0] == '_' ||
+		name == "testdata" || name == "vendor"
+}
+
+// readLocalDir loads documentation files of root path into memory,
+// and collects all subdirectories which contain Go source files.
+func (w *Walker) readLocalDir(wr *WalkRes) ([]*Source, []string, error) {
+	wr.RootPath = filepath.Clean(wr.RootPath)
+	fis, err := ioutil.ReadDir(wr.RootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srcs := make([]*Source, 0, len(fis))
+	for _, fi := range fis {
+		if fi.IsDir() || !base.IsDocFile(fi.Name()) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(wr.RootPath, fi.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		src := &Source{
+			SrcName: fi.Name(),
+			SrcData: data,
+		}
+		if len(wr.BrowseUrlTpl) > 0 {
+			src.BrowseUrl = com.Expand(wr.BrowseUrlTpl, nil, fi.Name())
+		}
+		srcs = append(srcs, src)
+	}
+
+	dirMap := make(map[string]bool)
+	err = filepath.Walk(wr.RootPath, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if fpath != wr.RootPath && isSkipDir(fi.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		d := filepath.Dir(fpath)
+		if d == wr.RootPath || !strings.HasSuffix(fi.Name(), ".go") ||
+			!base.IsDocFile(fi.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(wr.RootPath, d)
+		if err != nil {
+			return err
+		}
+		dirMap[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return srcs, base.MapToSortedStrings(dirMap), nil
+}
+
+// ------------------------------
+// WT_Zip and WT_TarGz
+// ------------------------------
+
+// archiveFile represents a regular file in archive.
+type archiveFile struct {
+	name string
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// readArchive loads documentation files of root path in archive into memory,
+// and collects all subdirectories which contain Go source files.
+func (w *Walker) readArchive(wr *WalkRes, files []*archiveFile) ([]*Source, []string, error) {
+	dirPrefix := strings.Trim(wr.RootPath, "/")
+	if len(dirPrefix) > 0 {
+		dirPrefix += "/"
+	}
+
+	srcs := make([]*Source, 0, 10)
+	dirMap := make(map[string]bool)
+	for _, f := range files {
+		if !strings.HasPrefix(f.name, dirPrefix) {
+			continue
+		}
+
+		d, fn := path.Split(f.name[len(dirPrefix):])
+		if !base.IsDocFile(fn) {
+			continue
+		}
+
+		// Check if it's a Go file in subdirectory.
+		if len(d) > 0 {
+			d = strings.TrimSuffix(d, "/")
+			if !strings.HasSuffix(fn, ".go") {
+				continue
+			}
+			for _, name := range strings.Split(d, "/") {
+				if isSkipDir(name) {
+					d = ""
+					break
+				}
+			}
+			if len(d) > 0 {
+				dirMap[d] = true
+			}
+			continue
+		}
+
+		rc, err := f.open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("open file '%s': %v", f.name, err)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(rc, f.size))
+		rc.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("read file '%s': %v", f.name, err)
+		}
+
+		src := &Source{
+			SrcName: fn,
+			SrcData: data,
+		}
+		if len(wr.BrowseUrlTpl) > 0 {
+			src.BrowseUrl = com.Expand(wr.BrowseUrlTpl, nil, fn)
+		}
+		srcs = append(srcs, src)
+	}
+
+	return srcs, base.MapToSortedStrings(dirMap), nil
+}
+
+func (w *Walker) readZip(wr *WalkRes) ([]*Source, []string, error) {
+	r, err := zip.NewReader(bytes.NewReader(wr.Archive), int64(len(wr.Archive)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := make([]*archiveFile, 0, len(r.File))
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, &archiveFile{
+			name: f.Name,
+			size: int64(f.UncompressedSize64),
+			open: f.Open,
+		})
+	}
+	return w.readArchive(wr, files)
+}
+
+func (w *Walker) readTarGz(wr *WalkRes) ([]*Source, []string, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(wr.Archive))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gr.Close()
+
+	// Tar archive can only be read sequentially, so keep file data in memory.
+	files := make([]*archiveFile, 0, 10)
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		// Reader reports files of old archives with TypeReg as well.
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(h.Name, "./")
+		if _, fn := path.Split(name); !base.IsDocFile(fn) {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read file '%s': %v", h.Name, err)
+		}
+		files = append(files, &archiveFile{
+			name: name,
+			size: int64(len(data)),
+			open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(data)), nil
+			},
+		})
+	}
+	return w.readArchive(wr, files)
 }
 
 // ------------------------------
@@ -109,7 +330,7 @@ func (w *Walker) openFile(path string) (io.ReadCloser, error) {
 func (w *Walker) setMemoryContext(ctxt *build.Context) {
 	ctxt.JoinPath = path.Join
 	ctxt.IsAbsPath = path.IsAbs
-	ctxt.IsDir = func(path string) bool { panic("unexpected") }
+	ctxt.IsDir = func(path string) bool { return path == w.Pdoc.ImportPath }
 	ctxt.HasSubdir = func(root, dir string) (rel string, ok bool) { panic("unexpected") }
 	ctxt.ReadDir = func(dir string) (fi []os.FileInfo, err error) { return w.readDir(dir) }
 	ctxt.OpenFile = func(path string) (r io.ReadCloser, err error) { return w.openFile(path) }
@@ -301,6 +522,7 @@ func (w *Walker) printPos(pos token.Pos) string {
 func (w *Walker) values(vdocs []*doc.Value) (vals []*Value) {
 	for _, d := range vdocs {
 		vals = append(vals, &Value{
+			Name: strings.Join(d.Names, ", "),
 			Decl: w.printDecl(d.Decl),
 			URL:  w.printPos(d.Decl.Pos()),
 			Doc:  d.Doc,
@@ -468,39 +690,64 @@ func (w *Walker) Build(wr *WalkRes) (*Package, error) {
 			return nil, errors.New("WT_Local: cannot find specific directory or it's a file")
 		}
 
-		w.setLocalContext(&ctxt)
-		return nil, errors.New("Hasn't supported yet!")
-	case WT_Memory:
-		// Convert source files.
-		w.SrcFiles = make(map[string]*Source)
-		w.Pdoc.Readme = make(map[string][]byte)
-		for _, src := range wr.Srcs {
-			srcName := strings.ToLower(src.Name()) // For readme comparation.
-			switch {
-			case strings.HasSuffix(src.Name(), ".go"):
-				w.SrcFiles[src.Name()] = src
-			case len(w.Pdoc.Tag) > 0 || (wr.WalkMode&WM_NoReadme != 0):
-				// This means we are not on the latest version of the code,
-				// so we do not collect the README files.
-				continue
-			case strings.HasPrefix(srcName, "readme_zh") || strings.HasPrefix(srcName, "readme_cn"):
-				w.Pdoc.Readme["zh"] = src.Data()
-			case strings.HasPrefix(srcName, "readme"):
-				w.Pdoc.Readme["en"] = src.Data()
-			}
+		srcs, dirs, err := w.readLocalDir(wr)
+		if err != nil {
+			return nil, errors.New("WT_Local: read directory: " + err.Error())
 		}
-
-		// Check source files.
-		if w.SrcFiles == nil {
-			return nil, errors.New("WT_Memory: no Go source file")
+		wr.Srcs = srcs
+		w.setDirs(dirs)
+	case WT_Zip, WT_TarGz:
+		// Check archive data.
+		if len(wr.Archive) == 0 {
+			return nil, errors.New("WT_Zip/WT_TarGz: empty archive")
 		}
 
-		w.setMemoryContext(&ctxt)
-
+		var (
+			srcs []*Source
+			dirs []string
+			err  error
+		)
+		if wr.WalkType == WT_Zip {
+			srcs, dirs, err = w.readZip(wr)
+		} else {
+			srcs, dirs, err = w.readTarGz(wr)
+		}
+		if err != nil {
+			return nil, errors.New("WT_Zip/WT_TarGz: read archive: " + err.Error())
+		}
+		wr.Srcs = srcs
+		w.setDirs(dirs)
+	case WT_Memory:
 	default:
 		return nil, errors.New("Hasn't supported yet!")
 	}
 
+	// Convert source files.
+	w.SrcFiles = make(map[string]*Source)
+	w.Pdoc.Readme = make(map[string][]byte)
+	for _, src := range wr.Srcs {
+		srcName := strings.ToLower(src.Name()) // For readme comparation.
+		switch {
+		case strings.HasSuffix(src.Name(), ".go"):
+			w.SrcFiles[src.Name()] = src
+		case len(w.Pdoc.Tag) > 0 || (wr.WalkMode&WM_NoReadme != 0):
+			// This means we are not on the latest version of the code,
+			// so we do not collect the README files.
+			continue
+		case strings.HasPrefix(srcName, "readme_zh") || strings.HasPrefix(srcName, "readme_cn"):
+			w.Pdoc.Readme["zh"] = src.Data()
+		case strings.HasPrefix(srcName, "readme"):
+			w.Pdoc.Readme["en"] = src.Data()
+		}
+	}
+
+	// Check source files.
+	if w.SrcFiles == nil {
+		return nil, errors.New("WT_Memory: no Go source file")
+	}
+
+	w.setMemoryContext(&ctxt)
+
 	var err error
 	var bpkg *build.Package
 
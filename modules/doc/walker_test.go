@@ -0,0 +1,355 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Unknwon/gowalker/models"
+)
+
+// testTree is a package with sub-packages at different levels,
+// directories that are skipped and files that are not documentation.
+var testTree = map[string]string{
+	"a.go":                  "package a\n",
+	"README.md":             "# a\n",
+	"notes.txt":             "notes\n",
+	"_a.go":                 "package a\n",
+	"sub/b.go":              "package b\n",
+	"sub/README":            "b\n",
+	"nested/deep/c.go":      "package c\n",
+	"nested/deep/c_test.go": "package c\n",
+	"assets/logo.png":       "png",
+	".hidden/d.go":          "package d\n",
+	"_skip/e.go":            "package e\n",
+	"testdata/f.go":         "package f\n",
+	"vendor/x.org/g/g.go":   "package g\n",
+	"sub/testdata/h.go":     "package h\n",
+}
+
+func srcNames(srcs []*Source) []string {
+	names := make([]string, len(srcs))
+	for i := range srcs {
+		names[i] = srcs[i].SrcName
+	}
+	return names
+}
+
+func TestIsSkipDir(t *testing.T) {
+	for name, expect := range map[string]bool{
+		"sub":      false,
+		"":         true,
+		".git":     true,
+		"_example": true,
+		"testdata": true,
+		"vendor":   true,
+	} {
+		if isSkipDir(name) != expect {
+			t.Errorf("isSkipDir(%q): expect %v", name, expect)
+		}
+	}
+}
+
+func TestReadLocalDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-walker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range testTree {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+		if err = ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &Walker{Pdoc: &Package{PkgInfo: &models.PkgInfo{}, PkgDecl: &PkgDecl{}}}
+	srcs, dirs, err := w.readLocalDir(&WalkRes{
+		RootPath:     dir + "/",
+		BrowseUrlTpl: "example.com/a/blob/{0}",
+	})
+	if err != nil {
+		t.Fatalf("readLocalDir: %v", err)
+	}
+
+	if names := srcNames(srcs); !reflect.DeepEqual(names, []string{"README.md", "a.go"}) {
+		t.Fatalf("expect sources README.md and a.go but got %v", names)
+	} else if string(srcs[1].SrcData) != testTree["a.go"] || srcs[1].BrowseUrl != "example.com/a/blob/a.go" {
+		t.Fatalf("unexpected source a.go: %+v", srcs[1])
+	}
+	if expect := []string{"nested/deep", "sub"}; !reflect.DeepEqual(dirs, expect) {
+		t.Fatalf("expect directories %v but got %v", expect, dirs)
+	}
+
+	// Directory without Go files is shown as long as it has packages inside.
+	w.setDirs(dirs)
+	if w.Pdoc.Subdirs != "nested|sub" {
+		t.Fatalf("expect subdirs 'nested|sub' but got %q", w.Pdoc.Subdirs)
+	}
+}
+
+// buildTestTree is a package with documentation, examples and sub-packages.
+var buildTestTree = map[string]string{
+	"a.go": `// Package a is a test package.
+package a
+
+// Kind is a kind of things.
+type Kind int
+
+// NewKind returns a new kind.
+func NewKind() Kind { return 0 }
+
+// String returns name of the kind.
+func (k Kind) String() string { return "" }
+
+// Hello says hello.
+func Hello() {}
+
+func hidden() {}
+`,
+	"example_test.go": `package a_test
+
+import "fmt"
+
+func ExampleHello() {
+	fmt.Println("hello")
+	// Output: hello
+}
+`,
+	"README.md":        "# a\n",
+	"sub/b.go":         "package b\n",
+	"nested/deep/c.go": "package c\n",
+	"testdata/d.go":    "package d\n",
+}
+
+// checkBuildTestTree checks documentation of build test tree.
+func checkBuildTestTree(t *testing.T, pdoc *Package) {
+	if pdoc.Synopsis != "Package a is a test package." {
+		t.Errorf("unexpected synopsis: %q", pdoc.Synopsis)
+	}
+	if len(pdoc.Funcs) != 1 || pdoc.Funcs[0].Name != "Hello" {
+		t.Errorf("expect only func Hello but got %d funcs", len(pdoc.Funcs))
+	}
+	if len(pdoc.Types) != 1 || pdoc.Types[0].Name != "Kind" {
+		t.Fatalf("expect only type Kind but got %d types", len(pdoc.Types))
+	}
+	kind := pdoc.Types[0]
+	if len(kind.Funcs) != 1 || kind.Funcs[0].Name != "NewKind" ||
+		len(kind.Methods) != 1 || kind.Methods[0].Name != "String" {
+		t.Errorf("expect func NewKind and method String of Kind but got %d funcs and %d methods",
+			len(kind.Funcs), len(kind.Methods))
+	}
+	if len(pdoc.Examples) != 1 || pdoc.Examples[0].Name != "Hello" || pdoc.Examples[0].Output != "hello\n" {
+		t.Errorf("expect example of Hello but got %d examples", len(pdoc.Examples))
+	}
+	if pdoc.Subdirs != "nested|sub" {
+		t.Errorf("expect subdirs 'nested|sub' but got %q", pdoc.Subdirs)
+	}
+	if string(pdoc.Readme["en"]) != buildTestTree["README.md"] {
+		t.Errorf("unexpected README: %q", pdoc.Readme["en"])
+	}
+}
+
+func TestBuildLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-walker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range buildTestTree {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+		if err = ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &Walker{
+		LineFmt: "#L%d",
+		Pdoc: &Package{
+			PkgInfo: &models.PkgInfo{ImportPath: "example.com/a"},
+		},
+	}
+	pdoc, err := w.Build(&WalkRes{
+		WalkDepth:    WD_All,
+		WalkType:     WT_Local,
+		WalkMode:     WM_All,
+		RootPath:     dir,
+		BrowseUrlTpl: "example.com/a/blob/{0}",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	checkBuildTestTree(t, pdoc)
+	if len(pdoc.Files) != 1 || pdoc.Files[0].BrowseUrl != "example.com/a/blob/a.go" {
+		t.Errorf("expect source file a.go but got %v", srcNames(pdoc.Files))
+	}
+}
+
+// sortedTestTree returns file names of given test tree in sorted order,
+// so archives are same every time.
+func sortedTestTree(tree map[string]string) []string {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTestZip returns zip archive of given test tree under given top-level directory,
+// with entries of directories as archives from code hosting sites.
+func newTestZip(t *testing.T, tree map[string]string, top string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	seen := make(map[string]bool)
+	for _, name := range sortedTestTree(tree) {
+		if d := path.Dir(top + name); !seen[d] {
+			seen[d] = true
+			if _, err := zw.Create(d + "/"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fw, err := zw.Create(top + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(tree[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestTarGz returns gzipped tar archive of given test tree under given
+// top-level directory, with entries of directories and a symbolic link.
+func newTestTarGz(t *testing.T, tree map[string]string, top string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	seen := make(map[string]bool)
+	for _, name := range sortedTestTree(tree) {
+		if d := path.Dir(top + name); !seen[d] {
+			seen[d] = true
+			if err := tw.WriteHeader(&tar.Header{Name: d + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data := []byte(tree[name])
+		if err := tw.WriteHeader(&tar.Header{Name: top + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: top + "link.go", Typeflag: tar.TypeSymlink, Linkname: "a.go"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	} else if err = gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	w := &Walker{Pdoc: &Package{PkgInfo: &models.PkgInfo{}, PkgDecl: &PkgDecl{}}}
+	for _, tc := range []struct {
+		walkType WalkType
+		archive  []byte
+	}{
+		{WT_Zip, newTestZip(t, testTree, "repo-1.0/")},
+		{WT_TarGz, newTestTarGz(t, testTree, "./repo-1.0/")},
+	} {
+		read := w.readZip
+		if tc.walkType == WT_TarGz {
+			read = w.readTarGz
+		}
+
+		srcs, dirs, err := read(&WalkRes{
+			RootPath:     "/repo-1.0/",
+			BrowseUrlTpl: "example.com/a/blob/{0}",
+			Archive:      tc.archive,
+		})
+		if err != nil {
+			t.Fatalf("%d: read archive: %v", tc.walkType, err)
+		}
+		if names := srcNames(srcs); !reflect.DeepEqual(names, []string{"README.md", "a.go"}) {
+			t.Fatalf("%d: expect sources README.md and a.go but got %v", tc.walkType, names)
+		} else if string(srcs[1].SrcData) != testTree["a.go"] || srcs[1].BrowseUrl != "example.com/a/blob/a.go" {
+			t.Fatalf("%d: unexpected source a.go: %+v", tc.walkType, srcs[1])
+		}
+		if expect := []string{"nested/deep", "sub"}; !reflect.DeepEqual(dirs, expect) {
+			t.Fatalf("%d: expect directories %v but got %v", tc.walkType, expect, dirs)
+		}
+
+		// Walk a sub-package, directories skipped by name are not included.
+		srcs, dirs, err = read(&WalkRes{
+			RootPath: "repo-1.0/sub",
+			Archive:  tc.archive,
+		})
+		if err != nil {
+			t.Fatalf("%d: read archive: %v", tc.walkType, err)
+		}
+		if names := srcNames(srcs); !reflect.DeepEqual(names, []string{"README", "b.go"}) {
+			t.Fatalf("%d: expect sources README and b.go but got %v", tc.walkType, names)
+		} else if len(dirs) != 0 {
+			t.Fatalf("%d: expect no directories but got %v", tc.walkType, dirs)
+		}
+	}
+}
+
+func TestBuildArchive(t *testing.T) {
+	for _, tc := range []struct {
+		walkType WalkType
+		archive  []byte
+	}{
+		{WT_Zip, newTestZip(t, buildTestTree, "repo-1.0/")},
+		{WT_TarGz, newTestTarGz(t, buildTestTree, "./repo-1.0/")},
+	} {
+		w := &Walker{
+			LineFmt: "#L%d",
+			Pdoc: &Package{
+				PkgInfo: &models.PkgInfo{ImportPath: "example.com/a"},
+			},
+		}
+		pdoc, err := w.Build(&WalkRes{
+			WalkDepth:    WD_All,
+			WalkType:     tc.walkType,
+			WalkMode:     WM_All,
+			RootPath:     "repo-1.0",
+			BrowseUrlTpl: "example.com/a/blob/{0}",
+			Archive:      tc.archive,
+		})
+		if err != nil {
+			t.Fatalf("%d: Build: %v", tc.walkType, err)
+		}
+		checkBuildTestTree(t, pdoc)
+	}
+}
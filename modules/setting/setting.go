@@ -15,6 +15,7 @@
 package setting
 
 import (
+	"strings"
 	"time"
 
 	"github.com/Unknwon/com"
@@ -31,16 +32,71 @@ var (
 	// Server settings.
 	HTTPPort     int
 	FetchTimeout time.Duration
-	DocsJsPath   string
-	DocsGobPath  string
+
+	// Private settings.
+	PrivateMode    bool
+	LocalSrcRoots  []string
+	LocalModRoots  []string
+	LocalBrowseURL string
+	OfflineMode    bool
+	GoProxyURL     string
+
+	// GitHub settings.
+	GitHubTokens            []string
+	GitHubAppID             string
+	GitHubAppInstallationID string
+	GitHubAppPrivateKey     string
+
+	// Forge settings.
+	GitLabInstances      []ForgeInstance
+	GiteaInstances       []ForgeInstance
+	BitbucketUser        string
+	BitbucketAppPassword string
+
+	// VCS settings.
+	VCSCachePath    string
+	VCSCacheMaxSize int64
+	VCSSparseFiles  int
+
+	// Crawler settings.
+	CrawlerEnabled         bool
+	CrawlerSchedule        string
+	CrawlerWorkers         int
+	CrawlerBatchSize       int
+	CrawlerRefreshInterval time.Duration
+	CrawlerHostInterval    time.Duration
+	CrawlerGitHubReserve   int
 
 	// Global settings.
-	Cfg               *ini.File
-	GitHubCredentials string
-	RefreshInterval   = 5 * time.Minute
+	Cfg             *ini.File
+	RefreshInterval = 5 * time.Minute
 )
 
-func init() {
+// ForgeInstance represents a forge instance and the access token that is
+// only sent to it.
+type ForgeInstance struct {
+	URL   string
+	Token string
+}
+
+// parseForgeInstances parses instances in form of "<base URL>|<token>",
+// token is optional.
+func parseForgeInstances(specs []string) []ForgeInstance {
+	instances := make([]ForgeInstance, 0, len(specs))
+	for _, spec := range specs {
+		fields := strings.SplitN(spec, "|", 2)
+		inst := ForgeInstance{URL: strings.TrimSpace(fields[0])}
+		if len(fields) == 2 {
+			inst.Token = strings.TrimSpace(fields[1])
+		}
+		instances = append(instances, inst)
+	}
+	return instances
+}
+
+// Init loads configuration from files in current working directory,
+// it must be called before settings are used.
+func Init() {
 	log.Prefix = "[Go Walker]"
 
 	sources := []interface{}{"conf/app.ini"}
@@ -63,10 +119,45 @@ func init() {
 	sec := Cfg.Section("server")
 	HTTPPort = sec.Key("HTTP_PORT").MustInt(8080)
 	FetchTimeout = time.Duration(sec.Key("FETCH_TIMEOUT").MustInt(60)) * time.Second
-	DocsJsPath = sec.Key("DOCS_JS_PATH").MustString("raw/docs/")
-	DocsGobPath = sec.Key("DOCS_GOB_PATH").MustString("raw/gob/")
 
-	GitHubCredentials = "client_id=" + Cfg.Section("github").Key("CLIENT_ID").String() +
-		"&client_secret=" + Cfg.Section("github").Key("CLIENT_SECRET").String()
+	sec = Cfg.Section("private")
+	PrivateMode = sec.Key("ENABLED").MustBool()
+	LocalSrcRoots = sec.Key("SRC_ROOTS").Strings(",")
+	LocalModRoots = sec.Key("MOD_ROOTS").Strings(",")
+	LocalBrowseURL = sec.Key("BROWSE_URL").String()
+	OfflineMode = sec.Key("OFFLINE").MustBool()
+
+	GoProxyURL = strings.TrimSuffix(Cfg.Section("goproxy").Key("URL").String(), "/")
+
+	sec = Cfg.Section("github")
+	GitHubTokens = sec.Key("TOKENS").Strings(",")
+	GitHubAppID = sec.Key("APP_ID").String()
+	GitHubAppInstallationID = sec.Key("APP_INSTALLATION_ID").String()
+	GitHubAppPrivateKey = sec.Key("APP_PRIVATE_KEY").String()
 
+	sec = Cfg.Section("gitlab")
+	GitLabInstances = parseForgeInstances(sec.Key("URLS").Strings(","))
+	sec = Cfg.Section("gitea")
+	GiteaInstances = parseForgeInstances(sec.Key("URLS").Strings(","))
+	sec = Cfg.Section("bitbucket")
+	BitbucketUser = sec.Key("USER").String()
+	BitbucketAppPassword = sec.Key("APP_PASSWORD").String()
+
+	sec = Cfg.Section("vcs")
+	VCSCachePath = sec.Key("CACHE_PATH").MustString("data/vcs")
+	VCSCacheMaxSize = sec.Key("MAX_CACHE_SIZE").MustInt64(2048) << 20
+	VCSSparseFiles = sec.Key("SPARSE_FILES").MustInt(5000)
+
+	sec = Cfg.Section("crawler")
+	CrawlerEnabled = sec.Key("ENABLED").MustBool()
+	CrawlerSchedule = sec.Key("SCHEDULE").MustString("@every 10m")
+	CrawlerWorkers = sec.Key("WORKERS").MustInt(2)
+	// Crawler would block forever without any worker.
+	if CrawlerWorkers < 1 {
+		CrawlerWorkers = 1
+	}
+	CrawlerBatchSize = sec.Key("BATCH_SIZE").MustInt(100)
+	CrawlerRefreshInterval = time.Duration(sec.Key("REFRESH_INTERVAL").MustInt(24)) * time.Hour
+	CrawlerHostInterval = time.Duration(sec.Key("HOST_INTERVAL").MustInt(2)) * time.Second
+	CrawlerGitHubReserve = sec.Key("GITHUB_RESERVE").MustInt(500)
 }
@@ -0,0 +1,104 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	blobBucket  = []byte("blobs")
+	mtimeBucket = []byte("mtimes") // Unix time of when blobs are saved.
+)
+
+// boltStorage saves blobs in an embedded key/value database file,
+// it can only be opened by one process at a time.
+type boltStorage struct {
+	db *bolt.DB
+}
+
+func newBoltStorage(path string) (*boltStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("create directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open database: %v", err)
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(blobBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(mtimeBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create buckets: %v", err)
+	}
+	return &boltStorage{db}, nil
+}
+
+func (s *boltStorage) Put(key string, data []byte) error {
+	mtime := make([]byte, 8)
+	binary.BigEndian.PutUint64(mtime, uint64(time.Now().Unix()))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(blobBucket).Put([]byte(key), data); err != nil {
+			return err
+		}
+		return tx.Bucket(mtimeBucket).Put([]byte(key), mtime)
+	})
+}
+
+func (s *boltStorage) Get(key string) (data []byte, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(blobBucket).Get([]byte(key))
+		if v == nil {
+			return ErrNotExist
+		}
+		// Value is only valid during the transaction.
+		data = append([]byte(nil), v...)
+		return nil
+	})
+	return data, err
+}
+
+func (s *boltStorage) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(blobBucket).Delete([]byte(key)); err != nil {
+			return err
+		}
+		return tx.Bucket(mtimeBucket).Delete([]byte(key))
+	})
+}
+
+func (s *boltStorage) Walk(fn func(key string, modTime time.Time) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		mtimes := tx.Bucket(mtimeBucket)
+		return tx.Bucket(blobBucket).ForEach(func(k, _ []byte) error {
+			var modTime time.Time
+			if v := mtimes.Get(k); len(v) == 8 {
+				modTime = time.Unix(int64(binary.BigEndian.Uint64(v)), 0)
+			}
+			return fn(string(k), modTime)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fsStorage saves blobs as files under root directory,
+// sharded by first two characters of key.
+type fsStorage struct {
+	root string
+}
+
+func (s *fsStorage) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(s.root, key)
+	}
+	return filepath.Join(s.root, key[:2], key)
+}
+
+func (s *fsStorage) Put(key string, data []byte) error {
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write to temporary file first so other instances never read partial data.
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (s *fsStorage) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return data, err
+}
+
+func (s *fsStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *fsStorage) Walk(fn func(key string, modTime time.Time) error) error {
+	err := filepath.Walk(s.root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+		return fn(fi.Name(), fi.ModTime())
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Client is used to send requests to S3, so a stalled service
+// does not block callers forever.
+var s3Client = &http.Client{Timeout: time.Minute}
+
+// s3Storage saves blobs as objects of a bucket in any S3-compatible service,
+// path-style URLs are used so it works with services other than AWS.
+type s3Storage struct {
+	endpoint  string
+	bucket    string
+	region    string
+	prefix    string
+	accessKey string
+	secretKey string
+}
+
+// uriEncode encodes string as required by AWS Signature Version 4.
+func uriEncode(s string, encodeSlash bool) string {
+	var buf bytes.Buffer
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign adds AWS Signature Version 4 to the request.
+func (s *s3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Query parameters are sorted by encoded key and value.
+	params := make([]string, 0, len(req.URL.Query()))
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		strings.Join(params, "&"),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// do sends a signed request for given object key, empty key means the bucket itself.
+func (s *s3Storage) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	p := "/" + s.bucket
+	if len(key) > 0 {
+		p += "/" + s.prefix + key
+	}
+	u := strings.TrimSuffix(s.endpoint, "/") + uriEncode(p, false)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now())
+	return s3Client.Do(req)
+}
+
+// s3Error returns error with status and message of the response.
+func s3Error(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("status %d: %s", resp.StatusCode, data)
+}
+
+func (s *s3Storage) Put(key string, data []byte) error {
+	resp, err := s.do("PUT", key, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3Storage) Get(key string) ([]byte, error) {
+	resp, err := s.do("GET", key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		return ioutil.ReadAll(resp.Body)
+	case 404:
+		return nil, ErrNotExist
+	}
+	return nil, s3Error(resp)
+}
+
+func (s *s3Storage) Delete(key string) error {
+	resp, err := s.do("DELETE", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 && resp.StatusCode != 200 && resp.StatusCode != 404 {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *s3Storage) Walk(fn func(key string, modTime time.Time) error) error {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {s.prefix},
+	}
+	for {
+		resp, err := s.do("GET", "", query, nil)
+		if err != nil {
+			return err
+		}
+
+		var result s3ListResult
+		if resp.StatusCode != 200 {
+			err = s3Error(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("list objects: %v", err)
+		}
+
+		for _, obj := range result.Contents {
+			if err = fn(strings.TrimPrefix(obj.Key, s.prefix), obj.LastModified); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
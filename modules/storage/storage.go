@@ -0,0 +1,119 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package storage saves generated documentation as blobs keyed by content hash,
+// so stores can be shared by multiple instances.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Unknwon/log"
+
+	"github.com/Unknwon/gowalker/modules/setting"
+)
+
+var ErrNotExist = errors.New("Blob does not exist")
+
+// Storage represents a blob store.
+type Storage interface {
+	// Put saves data with given key, it's fine to overwrite an existing blob
+	// because same key always has same data.
+	Put(key string, data []byte) error
+	// Get returns data of given key, it returns ErrNotExist if not found.
+	Get(key string) ([]byte, error)
+	// Delete removes blob of given key, it's not an error if not found.
+	Delete(key string) error
+	// Walk calls fn with key and last modified time of every blob.
+	Walk(fn func(key string, modTime time.Time) error) error
+}
+
+var store Storage
+
+// newStorage creates a new store based on storage type in configuration.
+func newStorage() (Storage, error) {
+	sec := setting.Cfg.Section("storage")
+	switch sec.Key("TYPE").In("fs", []string{"fs", "bolt", "s3"}) {
+	case "bolt":
+		return newBoltStorage(sec.Key("PATH").MustString("data/blobs.db"))
+	case "s3":
+		return &s3Storage{
+			endpoint:  sec.Key("ENDPOINT").MustString("https://s3.amazonaws.com"),
+			bucket:    sec.Key("BUCKET").String(),
+			region:    sec.Key("REGION").MustString("us-east-1"),
+			prefix:    sec.Key("PREFIX").String(),
+			accessKey: sec.Key("ACCESS_KEY").String(),
+			secretKey: sec.Key("SECRET_KEY").String(),
+		}, nil
+	default:
+		return &fsStorage{root: sec.Key("PATH").MustString("data/blobs")}, nil
+	}
+}
+
+// Init opens store in configuration, it must be called after settings are loaded.
+func Init() {
+	var err error
+	store, err = newStorage()
+	if err != nil {
+		log.FatalD(4, "Fail to init storage: %v", err)
+	}
+}
+
+// Key returns content hash of data.
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put saves data with given key which is usually content hash of it.
+func Put(key string, data []byte) error {
+	return store.Put(key, data)
+}
+
+// Get returns data of given key.
+func Get(key string) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrNotExist
+	}
+	return store.Get(key)
+}
+
+// GC removes blobs that are not in use and older than grace period,
+// it returns number of removed blobs. The grace period protects blobs
+// of generations that haven't been saved to database.
+func GC(inUse map[string]bool, grace time.Duration) (int, error) {
+	deadline := time.Now().Add(-grace)
+
+	// Collect keys first because not all stores allow deleting while walking.
+	orphans := make([]string, 0, 10)
+	if err := store.Walk(func(key string, modTime time.Time) error {
+		if !inUse[key] && modTime.Before(deadline) {
+			orphans = append(orphans, key)
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("walk: %v", err)
+	}
+
+	for i, key := range orphans {
+		if err := store.Delete(key); err != nil {
+			return i, fmt.Errorf("delete %s: %v", key, err)
+		}
+	}
+	return len(orphans), nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testStorage checks basic operations that every store must support.
+func testStorage(t *testing.T, s Storage) {
+	if _, err := s.Get("missing"); err != ErrNotExist {
+		t.Fatalf("Get missing blob: expect ErrNotExist but got: %v", err)
+	}
+
+	blobs := map[string]string{
+		Key([]byte("hello")): "hello",
+		Key([]byte("world")): "world",
+	}
+	for key, data := range blobs {
+		if err := s.Put(key, []byte(data)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	// Overwriting with same data is fine.
+	if err := s.Put(Key([]byte("hello")), []byte("hello")); err != nil {
+		t.Fatalf("Put existing blob: %v", err)
+	}
+
+	for key, expect := range blobs {
+		data, err := s.Get(key)
+		if err != nil {
+			t.Fatalf("Get %s: %v", key, err)
+		} else if string(data) != expect {
+			t.Fatalf("Get %s: expect %q but got %q", key, expect, data)
+		}
+	}
+
+	keys := make([]string, 0, len(blobs))
+	if err := s.Walk(func(key string, modTime time.Time) error {
+		if modTime.IsZero() {
+			t.Errorf("Walk %s: zero modification time", key)
+		}
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || blobs[keys[0]] == "" || blobs[keys[1]] == "" {
+		t.Fatalf("Walk: expect keys of blobs but got %v", keys)
+	}
+
+	key := Key([]byte("hello"))
+	if err := s.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	} else if _, err = s.Get(key); err != ErrNotExist {
+		t.Fatalf("Get deleted blob: expect ErrNotExist but got: %v", err)
+	}
+	if err := s.Delete(key); err != nil {
+		t.Fatalf("Delete missing blob: %v", err)
+	}
+}
+
+func TestFSStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Walking a store that has nothing saved is not an error.
+	s := &fsStorage{root: filepath.Join(dir, "blobs")}
+	if err = s.Walk(func(string, time.Time) error { return nil }); err != nil {
+		t.Fatalf("Walk empty store: %v", err)
+	}
+	testStorage(t, s)
+}
+
+func TestBoltStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newBoltStorage(filepath.Join(dir, "data", "blobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+	testStorage(t, s)
+}
+
+func TestGC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gw-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := &fsStorage{root: dir}
+	oldStore := store
+	store = fs
+	defer func() { store = oldStore }()
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"orphan", "inuse", "recent"} {
+		if err = Put(key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+		if key != "recent" {
+			if err = os.Chtimes(fs.path(key), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Only old blobs that are not in use are removed, recent ones may belong to
+	// generations being saved.
+	n, err := GC(map[string]bool{"inuse": true}, time.Hour)
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	} else if n != 1 {
+		t.Fatalf("GC: expect 1 blob to be removed but got %d", n)
+	}
+	if _, err = Get("orphan"); err != ErrNotExist {
+		t.Fatalf("orphan blob is not removed: %v", err)
+	}
+	for _, key := range []string{"inuse", "recent"} {
+		if _, err = Get(key); err != nil {
+			t.Fatalf("Get %s: %v", key, err)
+		}
+	}
+}
@@ -154,6 +154,36 @@ $(document).ready(function () {
     });
 
 
+    // Documentation generating job.
+    var $job = $('#job');
+    if ($job.length) {
+        var checkJob = function () {
+            $.getJSON('/api/v1/jobs/' + $job.data('id'), function (job) {
+                if (job.state == 'done') {
+                    window.location.href = $job.data('link');
+                    return;
+                } else if (job.state == 'failed') {
+                    $job.removeClass('icon');
+                    $job.find('.icon').remove();
+                    $('#job-state').text($job.data('failed') + ' ' + job.error);
+                    $('#job-retry').show();
+                    return;
+                }
+
+                var state = job.state;
+                if (state == 'downloading' && job.num_files > 0) {
+                    state = 'downloading_files';
+                }
+                $('#job-state').text($job.data(state).replace('%d', job.num_files));
+                setTimeout(checkJob, 1000);
+            }).fail(function () {
+                // Job has gone, try to load the page.
+                window.location.href = $job.data('link');
+            });
+        };
+        checkJob();
+    }
+
     // Browse history.
     if ($('#browse_history').length) {
         $(this).each(function () {
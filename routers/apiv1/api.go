@@ -15,9 +15,95 @@
 package apiv1
 
 import (
+	"path"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/Unknwon/gowalker/models"
+	"github.com/Unknwon/gowalker/modules/badge"
+	"github.com/Unknwon/gowalker/modules/base"
 	"github.com/Unknwon/gowalker/modules/context"
+	"github.com/Unknwon/gowalker/modules/doc"
 )
 
+// Badge renders SVG badge of Go Walker or information of given package.
+// Supported information by "show": name, stars, refs and updated.
 func Badge(ctx *context.Context) {
-	ctx.Redirect("https://img.shields.io/badge/Go%20Walker-API%20Documentation-green.svg?style=flat-square")
+	label, message, color := "Go Walker", "API Documentation", badge.COLOR_GREEN
+
+	if importPath := ctx.Query("path"); len(importPath) > 0 {
+		pinfo, err := models.GetPkgInfo(importPath)
+		if err != nil && err != models.ErrPackageVersionTooOld {
+			message, color = "unknown", badge.COLOR_GREY
+		} else {
+			color = badge.COLOR_BLUE
+			switch ctx.Query("show") {
+			case "stars":
+				label, message = "stars", com.ToStr(pinfo.Stars)
+			case "refs":
+				label, message = "imported by", com.ToStr(pinfo.RefNum)
+			case "updated":
+				label, message = "generated", time.Unix(pinfo.Created, 0).UTC().Format("2006-01-02")
+			default:
+				message, color = path.Base(pinfo.ImportPath), badge.COLOR_GREEN
+			}
+		}
+	}
+
+	ctx.Resp.Header().Set("Content-Type", "image/svg+xml")
+	ctx.Resp.Header().Set("Cache-Control", "max-age=300")
+	ctx.Resp.Write(badge.Render(label, message, color, badge.ParseStyle(ctx.Query("style"))))
+}
+
+// Job responses status of a documentation generation job.
+func Job(ctx *context.Context) {
+	job := doc.GetJob(ctx.Params(":id"))
+	if job == nil {
+		ctx.JSON(404, map[string]interface{}{
+			"error": "job not found",
+		})
+		return
+	}
+
+	ctx.JSON(200, job.Status())
+}
+
+// Diff responses differences of exported API between two versions of a package.
+func Diff(ctx *context.Context) {
+	oldVer := ctx.Query("old")
+	newVer := ctx.Query("new")
+	if !base.IsValidVersion(oldVer) || !base.IsValidVersion(newVer) {
+		ctx.JSON(422, map[string]interface{}{
+			"error": "invalid version",
+		})
+		return
+	}
+
+	importPath := ctx.Params("*")
+	diff, err := doc.GetAPIDiff(ctx.Req.Context(), ctx.Render, importPath, oldVer, newVer)
+	if err != nil {
+		handleDocError(ctx, err, doc.DocPath(importPath, oldVer), doc.DocPath(importPath, newVer))
+		return
+	}
+	ctx.JSON(200, diff)
+}
+
+// handleDocError responses error of getting documentation of given doc paths,
+// ID of unfinished job is included if documentation is being generated.
+func handleDocError(ctx *context.Context, err error, docPaths ...string) {
+	status := 500
+	data := map[string]interface{}{
+		"error": err.Error(),
+	}
+	switch err {
+	case doc.ErrGenerating:
+		status = 202
+		if job := doc.GetUnfinishedJob(docPaths...); job != nil {
+			data["job_id"] = job.Status().ID
+		}
+	case doc.ErrInvalidRemotePath, doc.ErrPackageNoGoFile:
+		status = 404
+	}
+	ctx.JSON(status, data)
 }
@@ -0,0 +1,203 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package apiv1
+
+import (
+	"strings"
+
+	"github.com/Unknwon/gowalker/modules/base"
+	"github.com/Unknwon/gowalker/modules/context"
+	"github.com/Unknwon/gowalker/modules/doc"
+)
+
+type apiValue struct {
+	Name string `json:"name"`
+	Decl string `json:"decl"`
+	Doc  string `json:"doc"`
+	URL  string `json:"url"`
+}
+
+type apiExample struct {
+	Name   string `json:"name"`
+	Doc    string `json:"doc"`
+	Code   string `json:"code"`
+	Output string `json:"output"`
+}
+
+type apiFunc struct {
+	Name     string        `json:"name"`
+	Decl     string        `json:"decl"`
+	Doc      string        `json:"doc"`
+	URL      string        `json:"url"`
+	Examples []*apiExample `json:"examples,omitempty"`
+}
+
+type apiType struct {
+	Name    string      `json:"name"`
+	Decl    string      `json:"decl"`
+	Doc     string      `json:"doc"`
+	URL     string      `json:"url"`
+	Consts  []*apiValue `json:"consts"`
+	Vars    []*apiValue `json:"vars"`
+	Funcs   []*apiFunc  `json:"funcs"`
+	Methods []*apiFunc  `json:"methods"`
+}
+
+type apiFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type apiPackage struct {
+	ImportPath  string        `json:"import_path"`
+	Version     string        `json:"version"`
+	ProjectPath string        `json:"project_path"`
+	Synopsis    string        `json:"synopsis"`
+	Doc         string        `json:"doc"` // In HTML.
+	IsCmd       bool          `json:"is_cmd"`
+	IsCgo       bool          `json:"is_cgo"`
+	Stars       int64         `json:"stars"`
+	Imports     []string      `json:"imports"`
+	TestImports []string      `json:"test_imports"`
+	Consts      []*apiValue   `json:"consts"`
+	Vars        []*apiValue   `json:"vars"`
+	Funcs       []*apiFunc    `json:"funcs"`
+	Types       []*apiType    `json:"types"`
+	Examples    []*apiExample `json:"examples"`
+	Subdirs     []string      `json:"subdirs"`
+	Files       []*apiFile    `json:"files"`
+}
+
+// sourceURL adds scheme to browse URL of VCS.
+func sourceURL(url string) string {
+	if len(url) == 0 || url[0] == '/' || strings.Contains(url, "://") {
+		return url
+	}
+	return "https://" + url
+}
+
+func toAPIValues(vals []*doc.Value) []*apiValue {
+	apiVals := make([]*apiValue, len(vals))
+	for i, v := range vals {
+		apiVals[i] = &apiValue{
+			Name: v.Name,
+			Decl: v.Decl,
+			Doc:  v.Doc,
+			URL:  sourceURL(v.URL),
+		}
+	}
+	return apiVals
+}
+
+func toAPIExamples(exams []*doc.Example) []*apiExample {
+	apiExams := make([]*apiExample, len(exams))
+	for i, e := range exams {
+		apiExams[i] = &apiExample{
+			Name:   e.Name,
+			Doc:    e.Doc,
+			Code:   e.Code,
+			Output: e.Output,
+		}
+	}
+	return apiExams
+}
+
+// toAPIFuncs converts functions with their examples,
+// examples are matched by prefix which is empty for package-level functions.
+func toAPIFuncs(funcs []*doc.Func, prefix string, exams []*doc.Example) []*apiFunc {
+	apiFuncs := make([]*apiFunc, len(funcs))
+	for i, f := range funcs {
+		apiFuncs[i] = &apiFunc{
+			Name: f.Name,
+			Decl: f.Decl,
+			Doc:  f.Doc,
+			URL:  sourceURL(f.URL),
+		}
+
+		name := prefix + f.Name
+		for _, e := range exams {
+			if e.Name == name || strings.HasPrefix(e.Name, name+"_") {
+				apiFuncs[i].Examples = append(apiFuncs[i].Examples, toAPIExamples([]*doc.Example{e})...)
+			}
+		}
+	}
+	return apiFuncs
+}
+
+func toAPIPackage(pdoc *doc.Package) *apiPackage {
+	pkg := &apiPackage{
+		ImportPath:  pdoc.ImportPath,
+		Version:     pdoc.Version,
+		ProjectPath: pdoc.ProjectPath,
+		Synopsis:    pdoc.Synopsis,
+		Doc:         pdoc.Doc,
+		IsCmd:       pdoc.IsCmd,
+		IsCgo:       pdoc.IsCgo,
+		Stars:       pdoc.Stars,
+		Imports:     pdoc.Imports,
+		TestImports: pdoc.TestImports,
+		Consts:      toAPIValues(pdoc.Consts),
+		Vars:        toAPIValues(pdoc.Vars),
+		Funcs:       toAPIFuncs(pdoc.Funcs, "", pdoc.Examples),
+		Types:       make([]*apiType, len(pdoc.Types)),
+		Examples:    toAPIExamples(pdoc.Examples),
+		Subdirs:     []string{},
+		Files:       make([]*apiFile, len(pdoc.Files)),
+	}
+
+	for i, t := range pdoc.Types {
+		pkg.Types[i] = &apiType{
+			Name:    t.Name,
+			Decl:    t.Decl,
+			Doc:     t.Doc,
+			URL:     sourceURL(t.URL),
+			Consts:  toAPIValues(t.Consts),
+			Vars:    toAPIValues(t.Vars),
+			Funcs:   toAPIFuncs(t.Funcs, "", pdoc.Examples),
+			Methods: toAPIFuncs(t.Methods, t.Name+"_", pdoc.Examples),
+		}
+	}
+
+	if len(pdoc.Subdirs) > 0 {
+		pkg.Subdirs = strings.Split(pdoc.Subdirs, "|")
+	}
+
+	for i, f := range pdoc.Files {
+		pkg.Files[i] = &apiFile{
+			Name: f.Name(),
+			URL:  sourceURL(f.BrowseUrl),
+		}
+	}
+	return pkg
+}
+
+// Package responses walked package documentation in JSON,
+// version can be specified in form of "<import path>@<version>".
+func Package(ctx *context.Context) {
+	importPath, version := base.ParseDocPath(ctx.Params("*"))
+	if !base.IsValidVersion(version) {
+		ctx.JSON(422, map[string]interface{}{
+			"error": "invalid version",
+		})
+		return
+	}
+
+	pdoc, err := doc.GetPackage(ctx.Req.Context(), importPath, version, ctx.Render)
+	if err != nil {
+		handleDocError(ctx, err, doc.DocPath(importPath, version))
+		return
+	}
+	ctx.JSON(200, toAPIPackage(pdoc))
+}
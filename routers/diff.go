@@ -0,0 +1,59 @@
+// Copyright 2015 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package routers
+
+import (
+	"errors"
+	"path"
+
+	"github.com/Unknwon/gowalker/modules/base"
+	"github.com/Unknwon/gowalker/modules/context"
+	"github.com/Unknwon/gowalker/modules/doc"
+)
+
+const (
+	DOCS_DIFF base.TplName = "docs/diff"
+)
+
+// Diff shows differences of exported API between two versions of a package.
+func Diff(ctx *context.Context) {
+	importPath := ctx.Params("*")
+	oldVer := ctx.Query("old")
+	newVer := ctx.Query("new")
+
+	ctx.Data["Title"] = importPath
+	ctx.Data["ImportPath"] = importPath
+	ctx.Data["ProjectName"] = path.Base(importPath)
+	ctx.Data["Old"] = oldVer
+	ctx.Data["New"] = newVer
+
+	if !base.IsValidVersion(oldVer) || !base.IsValidVersion(newVer) {
+		handleError(ctx, errors.New("invalid version"))
+		return
+	} else if oldVer == newVer {
+		ctx.HTML(200, DOCS_DIFF)
+		return
+	}
+
+	diff, err := doc.GetAPIDiff(ctx.Req.Context(), ctx.Render, importPath, oldVer, newVer)
+	if err != nil {
+		handleError(ctx, err, doc.DocPath(importPath, oldVer), doc.DocPath(importPath, newVer))
+		return
+	}
+
+	ctx.Data["PageIsDiff"] = true
+	ctx.Data["Diff"] = diff
+	ctx.HTML(200, DOCS_DIFF)
+}
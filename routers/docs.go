@@ -27,14 +27,19 @@ import (
 	"github.com/Unknwon/gowalker/modules/base"
 	"github.com/Unknwon/gowalker/modules/context"
 	"github.com/Unknwon/gowalker/modules/doc"
-	"github.com/Unknwon/gowalker/modules/setting"
+	"github.com/Unknwon/gowalker/modules/storage"
 )
 
 const (
-	DOCS         base.TplName = "docs/docs"
-	DOCS_IMPORTS base.TplName = "docs/imports"
+	DOCS            base.TplName = "docs/docs"
+	DOCS_IMPORTS    base.TplName = "docs/imports"
+	DOCS_GENERATING base.TplName = "docs/generating"
 )
 
+// MAX_REFS is the maximum number of packages shown as references,
+// popular packages are imported by too many to be listed.
+const MAX_REFS = 100
+
 // updateHistory updates browser history.
 func updateHistory(ctx *context.Context, id int64) {
 	pairs := make([]string, 1, 10)
@@ -62,11 +67,25 @@ func updateHistory(ctx *context.Context, id int64) {
 	ctx.SetCookie("user_history", strings.Join(pairs, "|"), 9999999)
 }
 
-func handleError(ctx *context.Context, err error) {
+// handleError handles error of getting documentation, progress of unfinished
+// job of given doc paths is shown if documentation is being generated,
+// doc path of the request is used if none is given.
+func handleError(ctx *context.Context, err error, docPaths ...string) {
 	importPath := ctx.Params("*")
 	if err == doc.ErrInvalidRemotePath {
 		ctx.Redirect("/search?q=" + importPath)
 		return
+	} else if err == doc.ErrGenerating {
+		ctx.Data["Title"] = importPath
+		ctx.Data["ImportPath"] = importPath
+		if len(docPaths) == 0 {
+			docPaths = []string{importPath}
+		}
+		if job := doc.GetUnfinishedJob(docPaths...); job != nil {
+			ctx.Data["JobID"] = job.Status().ID
+		}
+		ctx.HTML(202, DOCS_GENERATING)
+		return
 	}
 
 	if strings.Contains(err.Error(), "<meta> not found") ||
@@ -74,7 +93,7 @@ func handleError(ctx *context.Context, err error) {
 		models.DeletePackageByPath(importPath)
 	}
 
-	ctx.Flash.Error(importPath+": "+strings.Replace(err.Error(), setting.GitHubCredentials, "{GitHubCredentials}", -1), true)
+	ctx.Flash.Error(importPath+": "+err.Error(), true)
 	ctx.Flash.Info(ctx.Tr("form.click_to_search", importPath), true)
 	Home(ctx)
 }
@@ -91,7 +110,10 @@ func specialHandles(ctx *context.Context, pinfo *models.PkgInfo) bool {
 	// Only show references.
 	if strings.HasSuffix(ctx.Req.RequestURI, "?refs") {
 		ctx.Data["PageIsRefs"] = true
-		ctx.Data["Packages"] = pinfo.GetRefs()
+		ctx.Data["Packages"] = pinfo.GetRefs(MAX_REFS)
+		if pinfo.RefNum > MAX_REFS {
+			ctx.Data["RefsNote"] = ctx.Tr("docs.refs.partial", MAX_REFS, pinfo.RefNum)
+		}
 		ctx.HTML(200, DOCS_IMPORTS)
 		return true
 	}
@@ -101,8 +123,7 @@ func specialHandles(ctx *context.Context, pinfo *models.PkgInfo) bool {
 		if !pinfo.CanRefresh() {
 			ctx.Flash.Info(ctx.Tr("docs.refresh.too_often"))
 		} else {
-			importPath := ctx.Params("*")
-			_, err := doc.CheckPackage(importPath, ctx.Render, doc.REQUEST_TYPE_REFRESH)
+			_, err := doc.CheckPackage(ctx.Req.Context(), pinfo.ImportPath, pinfo.Version, ctx.Render, doc.REQUEST_TYPE_REFRESH)
 			if err != nil {
 				handleError(ctx, err)
 				return true
@@ -116,7 +137,7 @@ func specialHandles(ctx *context.Context, pinfo *models.PkgInfo) bool {
 }
 
 func Docs(ctx *context.Context) {
-	importPath := ctx.Params("*")
+	importPath, version := base.ParseDocPath(ctx.Params("*"))
 
 	// Check if import path looks like a vendor directory.
 	if strings.Contains(importPath, "/vendor/") {
@@ -124,23 +145,33 @@ func Docs(ctx *context.Context) {
 		return
 	}
 
+	if !base.IsValidVersion(version) {
+		handleError(ctx, errors.New("invalid version: "+version))
+		return
+	}
+
 	if base.IsGAERepoPath(importPath) {
 		ctx.Redirect("/google.golang.org/" + importPath)
 		return
 	}
 
-	pinfo, err := doc.CheckPackage(importPath, ctx.Render, doc.REQUEST_TYPE_HUMAN)
+	pinfo, err := doc.CheckPackage(ctx.Req.Context(), importPath, version, ctx.Render, doc.REQUEST_TYPE_HUMAN)
 	if err != nil {
 		handleError(ctx, err)
 		return
 	}
 
 	ctx.Data["PageIsDocs"] = true
-	ctx.Data["Title"] = pinfo.ImportPath
+	ctx.Data["Title"] = pinfo.DocPath()
 	ctx.Data["ParentPath"] = path.Dir(pinfo.ImportPath)
 	ctx.Data["ProjectName"] = path.Base(pinfo.ImportPath)
 	ctx.Data["ProjectPath"] = pinfo.ProjectPath
 	ctx.Data["NumStars"] = pinfo.Stars
+	ctx.Data["ImportPath"] = pinfo.ImportPath
+	ctx.Data["Version"] = pinfo.Version
+	if len(pinfo.Tags) > 0 {
+		ctx.Data["Tags"] = strings.Split(pinfo.Tags, "|")
+	}
 
 	if specialHandles(ctx, pinfo) {
 		return
@@ -152,27 +183,32 @@ func Docs(ctx *context.Context) {
 
 	ctx.Data["PkgDesc"] = pinfo.Synopsis
 
-	// README.
-	lang := ctx.Data["Lang"].(string)[:2]
-	readmePath := setting.DocsJsPath + pinfo.ImportPath + "_RM_" + lang + ".js"
-	if com.IsFile(readmePath) {
-		ctx.Data["IsHasReadme"] = true
-		ctx.Data["ReadmePath"] = readmePath
-	} else {
-		readmePath := setting.DocsJsPath + pinfo.ImportPath + "_RM_en.js"
-		if com.IsFile(readmePath) {
-			ctx.Data["IsHasReadme"] = true
-			ctx.Data["ReadmePath"] = readmePath
+	// Documentation.
+	docPage, err := doc.ReadDocPage(pinfo)
+	if err == storage.ErrNotExist {
+		// Blob could be removed from a shared storage, generate it again.
+		if err = models.ResetPkgDocKey(pinfo.ID); err != nil {
+			handleError(ctx, fmt.Errorf("reset doc key: %v", err))
+			return
 		}
+		pinfo, err = doc.CheckPackage(ctx.Req.Context(), importPath, version, ctx.Render, doc.REQUEST_TYPE_HUMAN)
+		if err != nil {
+			handleError(ctx, err)
+			return
+		}
+		docPage, err = doc.ReadDocPage(pinfo)
+	}
+	if err != nil {
+		handleError(ctx, fmt.Errorf("read doc page: %v", err))
+		return
 	}
+	ctx.Data["DocPage"] = docPage
 
-	// Documentation.
-	docJS := make([]string, 0, pinfo.JsNum+1)
-	docJS = append(docJS, setting.DocsJsPath+importPath+".js")
-	for i := 1; i <= pinfo.JsNum; i++ {
-		docJS = append(docJS, fmt.Sprintf("%s%s-%d.js", setting.DocsJsPath, importPath, i))
+	// README.
+	if readme := doc.ReadPkgDoc(pinfo, ctx.Data["Lang"].(string)[:2]); len(readme) > 0 {
+		ctx.Data["IsHasReadme"] = true
+		ctx.Data["Readme"] = readme
 	}
-	ctx.Data["DocJS"] = docJS
 	ctx.Data["Timestamp"] = pinfo.Created
 	if time.Now().UTC().Add(-5*time.Second).Unix() < pinfo.Created {
 		ctx.Flash.Success(ctx.Tr("docs.generate_success"), true)
@@ -182,7 +218,7 @@ func Docs(ctx *context.Context) {
 	if len(pinfo.Subdirs) > 0 {
 		ctx.Data["IsHasSubdirs"] = true
 		ctx.Data["ViewDirPath"] = pinfo.ViewDirPath
-		ctx.Data["Subdirs"] = models.GetSubPkgs(pinfo.ImportPath, strings.Split(pinfo.Subdirs, "|"))
+		ctx.Data["Subdirs"] = models.GetSubPkgs(pinfo.ImportPath, pinfo.Version, strings.Split(pinfo.Subdirs, "|"))
 	}
 
 	// Imports and references.
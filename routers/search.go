@@ -15,11 +15,6 @@
 package routers
 
 import (
-	"bytes"
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"strings"
 	"unicode"
 
@@ -49,20 +44,13 @@ func Search(ctx *context.Context) {
 		return
 	}
 
-	var (
-		results []*models.PkgInfo
-		err     error
-	)
-	switch q {
-	case "gorepos":
-		results, err = models.GetGoRepos()
-	case "gosubrepos":
-		results, err = models.GetGoSubepos()
-	case "gaesdk":
-		results, err = models.GetGAERepos()
-	default:
-		results, err = models.SearchPkgInfo(100, q)
+	opts := models.ParseSearchQuery(q)
+	limit := 100
+	if len(opts.Keyword) == 0 {
+		// Listing by filters only, e.g. all packages of standard library.
+		limit = 500
 	}
+	results, err := models.SearchPkgInfo(limit, opts)
 	if err != nil {
 		ctx.Flash.Error(err.Error(), true)
 	} else {
@@ -79,95 +67,24 @@ type searchResult struct {
 	URL         string `json:"url"`
 }
 
-type semanticSearchResultDefDocs struct {
-	Data string
-}
-
-type semanticSearchResultDef struct {
-	Exported bool
-	Kind     string
-	Unit     string
-	Path     string
-	Docs     []*semanticSearchResultDefDocs
-}
-
-type semanticSearchResult struct {
-	Defs []*semanticSearchResultDef
-}
-
-// semanticSearch sends search request to sourcegraph.com.
-// If repo is empty, try again when no results found in first attempt,
-// otherwise, response no results tp client.
-func semanticSearch(ctx *context.Context, query, repo string) {
-	url := "https://sourcegraph.com/.api/global-search?Query=golang+" + url.QueryEscape(query) + "&Limit=30&Fast=1&Repos=" + url.QueryEscape(repo)
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Error("semanticSearch.http.Get (%s): %v", url, err)
-		return
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
+// semanticSearch responses exported objects match query in form of "pkg#Type_Method".
+func semanticSearch(ctx *context.Context, query string) {
+	exports, err := models.SearchPkgExports(7, query)
 	if err != nil {
-		log.Error("semanticSearch.ioutil.ReadAll (%s): %v", url, err)
-		return
-	}
-	data = bytes.TrimSpace(data)
-
-	if len(data) == 0 {
-		if len(repo) == 0 {
-			semanticSearch(ctx, query, "github.com/golang/go")
-		} else {
-			ctx.JSON(200, map[string]interface{}{
-				"results": nil,
-			})
-		}
-		return
-	}
-
-	var sgResults semanticSearchResult
-	if err = json.Unmarshal(data, &sgResults); err != nil {
-		log.Error("semanticSearch.json.Unmarshal (%s): %v", url, err)
-		log.Error("JSON: %s", string(data))
+		log.ErrorD(4, "SearchPkgExports '%s': %v", query, err)
+		ctx.JSON(500, map[string]interface{}{
+			"error": err.Error(),
+		})
 		return
 	}
 
-	maxResults := 7
-	results := make([]*searchResult, 0, maxResults)
-	for _, def := range sgResults.Defs {
-		if !def.Exported {
-			continue
-		}
-
-		var title, desc, url string
-		switch def.Kind {
-		case "package":
-			title = def.Unit
-		case "func":
-			// recevier/method -> recevier_method
-			anchor := strings.Replace(def.Path, "/", "_", 1)
-			title = def.Unit + "#" + anchor
-		default:
-			continue
-		}
-
-		// Limit length of description to 100.
-		if len(def.Docs) > 0 {
-			if len(def.Docs[0].Data) > 100 {
-				desc = def.Docs[0].Data[:100] + "..."
-			} else {
-				desc = def.Docs[0].Data
-			}
-		}
-		url = "/" + title
-
-		results = append(results, &searchResult{
+	results := make([]*searchResult, len(exports))
+	for i := range exports {
+		title := exports[i].ImportPath + "#" + exports[i].Anchor
+		results[i] = &searchResult{
 			Title:       title,
-			Description: desc,
-			URL:         url,
-		})
-
-		if len(results) >= maxResults {
-			break
+			Description: exports[i].Desc,
+			URL:         "/" + title,
 		}
 	}
 
@@ -184,23 +101,30 @@ func SearchJSON(ctx *context.Context) {
 		return unicode.IsSpace(c) || c == '"'
 	})
 
-	// if ctx.Query("semantic_search") == "true" {
-	// 	semanticSearch(ctx, q, "")
-	// 	return
-	// }
+	if ctx.Query("semantic_search") == "true" {
+		semanticSearch(ctx, q)
+		return
+	}
 
-	pinfos, err := models.SearchPkgInfo(7, q)
+	pinfos, err := models.SearchPkgInfo(7, models.ParseSearchQuery(q))
 	if err != nil {
 		log.ErrorD(4, "SearchPkgInfo '%s': %v", q, err)
+		ctx.JSON(500, map[string]interface{}{
+			"error": err.Error(),
+		})
 		return
 	}
 
 	results := make([]*searchResult, len(pinfos))
 	for i := range pinfos {
+		title := pinfos[i].ImportPath
+		if len(pinfos[i].Anchor) > 0 {
+			title += "#" + pinfos[i].Anchor
+		}
 		results[i] = &searchResult{
-			Title:       pinfos[i].ImportPath,
+			Title:       title,
 			Description: pinfos[i].Synopsis,
-			URL:         "/" + pinfos[i].ImportPath,
+			URL:         "/" + title,
 		}
 	}
 